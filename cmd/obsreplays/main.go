@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -18,10 +19,13 @@ import (
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/widget"
 	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/diagnostics"
 	"github.com/owlcms/obsreplays/internal/httpServer"
 	"github.com/owlcms/obsreplays/internal/logging"
 	"github.com/owlcms/obsreplays/internal/monitor"
 	"github.com/owlcms/obsreplays/internal/recording"
+	"github.com/owlcms/obsreplays/internal/state"
+	"github.com/owlcms/obsreplays/internal/trigger"
 )
 
 var sigChan = make(chan os.Signal, 1)
@@ -152,6 +156,26 @@ func showPlatformSelection(cfg *config.Config, window fyne.Window) {
 	dialog.Show()
 }
 
+// offerInterruptedRecording asks whether to finalize the camera files of a recording left in progress
+func offerInterruptedRecording(snapshot *state.RecordingSnapshot, window fyne.Window) {
+	message := fmt.Sprintf("A recording was in progress when obsreplays last stopped:\n%s - %s attempt %d\n\nFinalize the leftover camera files into session %q?",
+		strings.ReplaceAll(snapshot.Athlete, "_", " "), snapshot.LiftType, snapshot.Attempt, snapshot.Session)
+	dialog.ShowConfirm("Interrupted Recording", message, func(finalize bool) {
+		if !finalize {
+			logging.InfoLogger.Println("Interrupted recording discarded by operator")
+			state.DiscardInterruptedRecording()
+			return
+		}
+		go func() {
+			if err := recording.FinalizeInterruptedRecording(snapshot); err != nil {
+				logging.ErrorLogger.Printf("Failed to finalize interrupted recording: %v", err)
+				httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: could not finalize interrupted recording - %v", err))
+				state.DiscardInterruptedRecording()
+			}
+		}()
+	}, window)
+}
+
 // confirmAndQuit shows a confirmation dialog and quits if confirmed
 func confirmAndQuit(window fyne.Window) {
 	confirmDialog := dialog.NewConfirm(
@@ -163,6 +187,8 @@ func confirmAndQuit(window fyne.Window) {
 
 				// Stop any ongoing recordings
 				recording.ForceStopRecordings()
+				recording.StopWarmupRecording()
+				waitForPendingJobs()
 
 				httpServer.StopServer()
 
@@ -177,12 +203,23 @@ func confirmAndQuit(window fyne.Window) {
 	confirmDialog.Show()
 }
 
+// waitForPendingJobs lets videos being processed in the background finish before exiting
+func waitForPendingJobs() {
+	if !recording.WaitForPendingJobs(60 * time.Second) {
+		logging.WarningLogger.Println("Timed out waiting for background video processing to finish")
+	}
+}
+
 func main() {
 	// Disable Fyne telemetry
 	os.Setenv("FYNE_TELEMETRY", "0")
 
 	// Process command-line flags and load configuration
 	cfg, err := config.InitConfig()
+	if err != nil && config.CheckOnly {
+		fmt.Printf("FAIL  configuration: %v\n", err)
+		os.Exit(1)
+	}
 	if err != nil {
 		logging.ErrorLogger.Fatalf("Error processing flags: %v", err)
 	}
@@ -191,15 +228,54 @@ func main() {
 	recording.SetNoVideo(config.NoVideo)
 	recording.SetVideoDir(cfg.VideoDir)
 
+	// Pre-flight check for setup scripts instead of starting the application
+	if config.CheckOnly {
+		fmt.Printf("PASS  configuration: %s\n", config.ConfigFile)
+		if !diagnostics.CheckConfig(cfg, os.Stdout) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// Produce a support report instead of starting the application
+	if config.Diagnose {
+		reportPath, err := diagnostics.WriteReport()
+		if err != nil {
+			fmt.Printf("Failed to write diagnostic report: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Diagnostic report written to %s\n", reportPath)
+		os.Exit(0)
+	}
+
 	// Initialize with an empty status
 	var initialStatus string
 	initialStatus = "Scanning for owlcms server..."
 
+	// Persist in-progress recordings so they can be finalized after a crash
+	state.SetStateFile(filepath.Join(config.GetInstallDir(), "recording_state.json"))
+
+	// Let the HTTP API drive the recorder
+	httpServer.ForceStopFunc = recording.ForceStopRecordings
+	httpServer.PreviewFunc = recording.CameraPreview
+	httpServer.ResetFunc = recording.Reset
+	httpServer.ReassignFunc = recording.ReassignReplays
+	httpServer.SelfTestFunc = recording.SelfTest
+	httpServer.CurrentRecordingFunc = recording.CurrentRecording
+	httpServer.HighlightsFunc = recording.ExportHighlights
+	httpServer.DeriveFunc = recording.DeriveSession
+	httpServer.OBSStatusFunc = recording.OBSStatus
+
 	// Start HTTP server
 	go func() {
 		httpServer.StartServer(cfg.Port, config.Verbose)
 	}()
 
+	// Check that ffmpeg can produce every output before the first lift
+	if !cfg.ReadOnly {
+		go recording.SelfTest()
+	}
+
 	myApp := app.New()
 	window := myApp.NewWindow("OWLCMS Jury Replays")
 
@@ -264,14 +340,9 @@ func main() {
 
 	// Status update goroutine
 	go func() {
-		var hideTimer *time.Timer
 		for msg := range httpServer.StatusChan {
-			if hideTimer != nil {
-				hideTimer.Stop()
-			}
-
-			// Skip showing "Reloading..." in the Fyne window
-			if msg.Text == "Reloading..." {
+			// The Idle status sent a while after the videos are ready brings the window back to "Ready"
+			if msg.Code == httpServer.Idle {
 				msg.Text = "Ready"
 			}
 
@@ -281,50 +352,86 @@ func main() {
 				Bold: strings.HasPrefix(msg.Text, "Error:"),
 			}
 			statusLabel.Refresh()
-
-			if msg.Code == httpServer.Ready {
-				hideTimer = time.AfterFunc(10*time.Second, func() {
-					statusLabel.SetText("Ready")
-					statusLabel.TextStyle = fyne.TextStyle{Bold: false}
-					statusLabel.Refresh()
-				})
-			}
 		}
 	}()
 
 	// Show the window before running the application
 	window.Show()
 
-	// Discover or verify MQTT broker after window is shown
+	// Connect to OBS and discover or verify the MQTT broker after window is shown, a read-only viewer
+	// records nothing
 	go func() {
-		broker, err := monitor.UpdateOwlcmsAddress(cfg, filepath.Join(config.GetInstallDir(), "config.toml"))
-		if err != nil {
-			logging.ErrorLogger.Printf("Failed to find MQTT broker: %v", err)
-			statusLabel.SetText(fmt.Sprintf("Error: Could not find owlcms server - %v", err))
-			statusLabel.TextStyle = fyne.TextStyle{Bold: true}
-			statusLabel.Refresh()
+		if cfg.ReadOnly {
+			logging.InfoLogger.Printf("Read-only viewer of %s, not connecting to owlcms and OBS", cfg.VideoDir)
+			httpServer.SendStatus(httpServer.Ready, "Read-only: browsing replays")
+			return
+		}
+		if err := recording.CheckVideoDir(); err != nil {
+			logging.ErrorLogger.Printf("Not recording: %v", err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
 			return
 		}
+		// OBS may start after obsreplays, the checks that need it are made once it is connected
+		var obsWaitStatus string
+		err := recording.InitializeRecorder(func() {
+			// Offer to finalize a recording interrupted by a crash or restart
+			if snapshot := state.LoadInterruptedRecording(); snapshot != nil {
+				offerInterruptedRecording(snapshot, window)
+			}
 
-		cfg.OwlCMS = broker
+			// Make sure the expected camera layout is loaded, and warn before the meet if OBS is not set
+			// up to produce the camera files
+			if err := recording.ApplyPlatformSettings(cfg.Platform); err != nil {
+				logging.ErrorLogger.Printf("OBS settings check failed: %v", err)
+				httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+			} else if err := recording.CheckSourceRecord(); err != nil {
+				logging.ErrorLogger.Printf("OBS Source Record check failed: %v", err)
+				httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+			} else if err := recording.CheckVideoSettings(); err != nil {
+				logging.WarningLogger.Printf("OBS video settings check failed: %v", err)
+				httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Warning: %v", err))
+			} else {
+				// Also replaces the error shown while waiting for OBS
+				httpServer.SendStatus(httpServer.Ready, "Ready")
+			}
+		}, func(err error) {
+			// Shown again only when the reason changes, e.g. OBS started without its WebSocket server
+			text := "Error: Could not connect to OBS - waiting for OBS to start with WebSocket server enabled"
+			if errors.Is(err, recording.ErrOBSWebSocketDisabled) {
+				text = fmt.Sprintf("Error: %v - waiting for OBS", recording.ErrOBSWebSocketDisabled)
+			}
+			if text != obsWaitStatus {
+				obsWaitStatus = text
+				httpServer.SendStatus(httpServer.Error, text)
+			}
+		})
+		if err != nil {
+			logging.WarningLogger.Printf("OBS is not available yet, retrying in the background: %v", err)
+		}
 
-		// Initialize recorder after owlcms is found
-		if err := recording.InitializeRecorder(); err != nil {
-			logging.ErrorLogger.Printf("Failed to connect to OBS: %v", err)
-			statusLabel.SetText(fmt.Sprintf("Error: Could not connect to OBS - check that OBS is running with WebSocket plugin enabled"))
-			statusLabel.TextStyle = fyne.TextStyle{Bold: true}
-			statusLabel.Refresh()
+		// Accept commands from local control software if configured, it does not need owlcms
+		go trigger.Listen(cfg.TriggerSocket)
+
+		broker, err := monitor.UpdateOwlcmsAddress(cfg, filepath.Join(config.GetInstallDir(), "config.toml"))
+		if err != nil {
+			logging.ErrorLogger.Printf("Failed to find MQTT broker: %v", err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: Could not find owlcms server - %v", err))
 			return
 		}
 
-		statusLabel.SetText("Ready")
-		statusLabel.TextStyle = fyne.TextStyle{Bold: false}
-		statusLabel.Refresh()
+		cfg.OwlCMS = broker
 
 		// Start MQTT monitor which handles platform list retrieval
 		go monitor.Monitor(cfg)
 	}()
 
+	// The warm-up camera does not depend on owlcms or OBS
+	if !cfg.ReadOnly {
+		if err := recording.StartWarmupRecording(); err != nil {
+			logging.ErrorLogger.Printf("Failed to start warm-up recording: %v", err)
+		}
+	}
+
 	// Initialize signal handling
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
@@ -333,6 +440,8 @@ func main() {
 		<-sigChan
 		logging.InfoLogger.Println("Interrupt signal received. Shutting down...")
 		recording.ForceStopRecordings()
+		recording.StopWarmupRecording()
+		waitForPendingJobs()
 		httpServer.StopServer()
 		myApp.Quit()
 	}()
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SplitArgs splits command-line parameters on spaces, keeping text in single or double quotes
+// together. Backslashes are kept as they are so that Windows paths need no escaping.
+func SplitArgs(s string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in %q", quote, s)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// FfmpegArgs returns the parsed ffmpegGlobalParams, ffmpegInputParams and ffmpegOutputParams
+func (c *Config) FfmpegArgs() (global, input, output []string) {
+	return c.ffmpegGlobalArgs, c.ffmpegInputArgs, c.ffmpegOutputArgs
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -12,18 +14,294 @@ import (
 	"github.com/owlcms/obsreplays/internal/logging"
 )
 
+// DefaultCameraFilePattern matches the Source Record files named ...Camera<id>.flv
+const DefaultCameraFilePattern = `^.*Camera(.*)\.flv$`
+
+// DefaultRecordingFormat is the extension of the files recorded by OBS when recordingFormat is not set
+const DefaultRecordingFormat = "flv"
+
+// InstallDirEnv is the environment variable giving the installation directory when -dir is not used
+const InstallDirEnv = "OBSREPLAYS_DIR"
+
+// DefaultOBSWebSocketURL is the address of the OBS WebSocket server when obsWebSocketUrl is not set
+const DefaultOBSWebSocketURL = "ws://localhost:4444"
+
+// Values of sourceRetention
+const (
+	SourceDelete  = "delete"
+	SourceArchive = "archive"
+	SourceKeep    = "keep"
+)
+
+// Values of noLiftAction
+const (
+	NoLiftMove    = "move"
+	NoLiftDiscard = "discard"
+)
+
+// Values of missingTimerStop
+const (
+	MissingTimerStopDecision = "decision"
+	MissingTimerStopFull     = "full"
+)
+
 // Config represents the configuration file structure
 type Config struct {
-	Port     int    `toml:"port"`
-	VideoDir string `toml:"videoDir"`
-	OwlCMS   string `toml:"owlcms"`
-	Platform string `toml:"platform"`
+	Port            int    `toml:"port"`
+	VideoDir        string `toml:"videoDir"`
+	OwlCMS          string `toml:"owlcms"`
+	Platform        string `toml:"platform"`
+	Group           string `toml:"group"` // only record this owlcms group (session) of the platform, all when empty
+	TimestampLayout string `toml:"timestampLayout"`
+	TimestampUTC    bool   `toml:"timestampUTC"`
+
+	// IgnoreStartsInBreak ignores clock starts from owlcms between the start and the end of a break
+	IgnoreStartsInBreak bool `toml:"ignoreStartsInBreak"`
+
+	// ReadOnly only serves the replays of videoDir for browsing: nothing is recorded and the API
+	// endpoints that change anything are refused
+	ReadOnly bool `toml:"readOnly"`
+
+	// FileNameFields are fields of the owlcms start message (team, category...) added after the
+	// athlete name in replay file names
+	FileNameFields []string `toml:"fileNameFields"`
+
+	// DatePrefix files sessions under a folder for the day they were recorded: <videoDir>/2024-05-01/<session>
+	DatePrefix bool `toml:"datePrefix"`
+
+	// LiftTypeFolders files the replays of a session under a folder per lift type: <session>/snatch
+	LiftTypeFolders bool `toml:"liftTypeFolders"`
+
+	// SessionIndex writes an index.html page and a playlist.m3u listing the replays of each session folder
+	SessionIndex bool `toml:"sessionIndex"`
+
+	// ArchiveDir receives a copy of every replay after it is ready in VideoDir, for a NAS archive
+	ArchiveDir string `toml:"archiveDir"`
+
+	// RecordStartTimeoutMs is how long to wait for OBS to confirm recording has started (0 disables the check)
+	RecordStartTimeoutMs int `toml:"recordStartTimeoutMs"`
+
+	// OBSWebSocketURL is the ws:// or wss:// address of the OBS WebSocket server. For wss://,
+	// OBSTLSSkipVerify accepts self-signed certificates and OBSCAFile trusts the CAs of a PEM file.
+	OBSWebSocketURL  string `toml:"obsWebSocketUrl"`
+	OBSTLSSkipVerify bool   `toml:"obsTlsSkipVerify"`
+	OBSCAFile        string `toml:"obsCaFile"`
+
+	// OBSConnectTimeoutSeconds limits how long connecting to the OBS WebSocket may take, default 5
+	OBSConnectTimeoutSeconds int `toml:"obsConnectTimeoutSeconds"`
+
+	// OBS tunes how long requests to OBS may take and how the connection is restored
+	OBS OBSClientSettings `toml:"obs"`
+
+	// QuietPeriodMs ignores starts and stops within this many milliseconds of a start (0 to disable)
+	QuietPeriodMs int `toml:"quietPeriodMs"`
+
+	// MaxRecordingSeconds stops and files a recording still running after this long, in case the
+	// owlcms stop is lost (0 for no limit)
+	MaxRecordingSeconds int `toml:"maxRecordingSeconds"`
+
+	// MaxClipSeconds is the longest replay kept after the trim point, so that a runaway recording
+	// does not produce a huge file (0 for no limit)
+	MaxClipSeconds int `toml:"maxClipSeconds"`
+
+	// PauseOnClockStop pauses the OBS recording when the clock stays stopped for PauseAfterMs
+	// without a decision, and resumes it when the clock restarts
+	PauseOnClockStop bool `toml:"pauseOnClockStop"`
+	PauseAfterMs     int  `toml:"pauseAfterMs"`
+
+	// CoalesceWindowMs continues the recording when a start follows a stop within this many milliseconds (0 to disable)
+	CoalesceWindowMs int `toml:"coalesceWindowMs"`
+
+	// StartHotkeys are the OBS hotkeys sent, in order, to start a recording, StartHotkeyDelayMs apart
+	StartHotkeys       []string `toml:"startHotkeys"`
+	StartHotkeyDelayMs int      `toml:"startHotkeyDelayMs"`
+
+	// TriggerSocket is the unix socket path (Linux) or named pipe (Windows) accepting START/STOP commands
+	TriggerSocket string `toml:"triggerSocket"`
+
+	// MQTTBroker is the URL of a broker relaying owlcms events, used instead of the owlcms broker
+	MQTTBroker      string `toml:"mqttBroker"`
+	MQTTUsername    string `toml:"mqttUsername"`
+	MQTTPassword    string `toml:"mqttPassword"`
+	MQTTTopicPrefix string `toml:"mqttTopicPrefix"`
+
+	// OwlcmsURL is the owlcms web server whose clock is compared to this computer's, by default
+	// port 8080 of the owlcms host. ClockOffsetWarningMs is the difference reported as a problem
+	// (0 disables the comparison).
+	OwlcmsURL            string `toml:"owlcmsUrl"`
+	ClockOffsetWarningMs int    `toml:"clockOffsetWarningMs"`
+
+	// BackgroundProcessing trims and files videos asynchronously so the next attempt can be recorded immediately
+	BackgroundProcessing bool `toml:"backgroundProcessing"`
+
+	// CopyAttempts is how many times copying a replay to the videos directory is tried, waiting
+	// CopyRetryDelayMs after the first failure and twice as long after each following one
+	CopyAttempts     int `toml:"copyAttempts"`
+	CopyRetryDelayMs int `toml:"copyRetryDelayMs"`
+
+	// MaxConcurrentJobs limits how many recordings are trimmed and filed at once (0 for no limit)
+	MaxConcurrentJobs int `toml:"maxConcurrentJobs"`
+
+	// WebCompatible encodes replays to H.264/AAC when OBS records in codecs browsers cannot play
+	WebCompatible bool `toml:"webCompatible"`
+
+	// QualityPreset re-encodes every replay with the named encoding settings (broadcast, web or archive)
+	QualityPreset string `toml:"qualityPreset"`
+
+	// OutputFps converts replays to this constant frame rate, which re-encodes them (0 to keep the recorded rate)
+	OutputFps float64 `toml:"outputFps"`
+
+	// LoudnessTarget normalizes the audio of replays to this integrated loudness in LUFS (0 to disable)
+	LoudnessTarget float64 `toml:"loudnessTarget"`
+
+	// SinglePassTrim has ffmpeg write the trimmed video straight to the session directory
+	SinglePassTrim bool `toml:"singlePassTrim"`
+
+	// FfmpegGlobalParams, FfmpegInputParams and FfmpegOutputParams are added to the trim command
+	// before the input options, before -i and before the output file
+	FfmpegGlobalParams string `toml:"ffmpegGlobalParams"`
+	FfmpegInputParams  string `toml:"ffmpegInputParams"`
+	FfmpegOutputParams string `toml:"ffmpegOutputParams"`
+	ffmpegGlobalArgs   []string
+	ffmpegInputArgs    []string
+	ffmpegOutputArgs   []string
+
+	// ReplayBuffer saves the OBS replay buffer at the decision instead of starting and stopping a recording
+	ReplayBuffer bool `toml:"replayBuffer"`
+
+	// FixedDuration keeps only the last seconds of each recording instead of using the owlcms clock (0 to disable)
+	FixedDuration int `toml:"fixedDuration"`
+
+	// ReadySound is played when a replay is ready. ReadyFlashSource is shown for ReadyFlashMs in
+	// ReadyFlashScene, the program scene by default.
+	ReadySound       string `toml:"readySound"`
+	ReadyFlashScene  string `toml:"readyFlashScene"`
+	ReadyFlashSource string `toml:"readyFlashSource"`
+	ReadyFlashMs     int    `toml:"readyFlashMs"`
+
+	// ReadyDebounceMs holds the Ready status back so that an attempt stopping meanwhile keeps
+	// the status at processing
+	ReadyDebounceMs int `toml:"readyDebounceMs"`
+
+	// IdleAfterSeconds is how long after Ready the Idle status is sent, when nothing happened meanwhile
+	// (0 to never send it)
+	IdleAfterSeconds int `toml:"idleAfterSeconds"`
+
+	// PreRecordCommand and PostRecordCommand are run when a recording starts and once its videos are ready
+	PreRecordCommand   string `toml:"preRecordCommand"`
+	PostRecordCommand  string `toml:"postRecordCommand"`
+	HookTimeoutSeconds int    `toml:"hookTimeoutSeconds"`
+
+	// SourceRetention selects what happens to the camera files once trimmed: deleted, archived in
+	// the raw folder of the session or kept in the captures directory
+	SourceRetention string `toml:"sourceRetention"`
+
+	// RecordOnlyGoodLifts keeps the replays of no-lifts out of the session directory, moving them to
+	// a nolifts folder or discarding them as selected by NoLiftAction
+	RecordOnlyGoodLifts bool   `toml:"recordOnlyGoodLifts"`
+	NoLiftAction        string `toml:"noLiftAction"`
+
+	// MissingTimerStop selects how a recording is trimmed when no timer stop was received:
+	// "decision" trims relative to the decision, "full" keeps the whole recording
+	MissingTimerStop string `toml:"missingTimerStop"`
+
+	// StatusHistorySize is the number of recent status messages kept for GET /api/status/history
+	StatusHistorySize int `toml:"statusHistorySize"`
+
+	// SplitErrorLog also writes warnings and errors to a separate errors.log
+	SplitErrorLog bool `toml:"splitErrorLog"`
+
+	// OBSSceneCollection and OBSProfile are expected in OBS for all platforms, unless OBSPlatforms says otherwise.
+	// OBSSwitchSettings switches OBS to the expected ones instead of only reporting the difference.
+	OBSSceneCollection string `toml:"obsSceneCollection"`
+	OBSProfile         string `toml:"obsProfile"`
+	OBSSwitchSettings  bool   `toml:"obsSwitchSettings"`
+
+	// OBSPlatforms maps an owlcms platform to the OBS scene collection and profile to load for it
+	OBSPlatforms map[string]OBSPlatformSettings `toml:"obsPlatforms"`
+
+	// Profiles are additional outputs produced for each camera from the trimmed video
+	Profiles []OutputProfile `toml:"profiles"`
+
+	// Vertical lists, by camera number, the cameras for which a 9:16 vertical video is produced
+	Vertical map[string]VerticalCrop `toml:"vertical"`
+
+	// RecordingFormat is the extension of the files OBS records (flv, mp4, mkv, mov...), used by the
+	// default cameraFilePattern
+	RecordingFormat string `toml:"recordingFormat"`
+
+	// CameraFilePattern is a regular expression matching the camera files in the captures directory,
+	// whose first group is the camera identifier
+	CameraFilePattern string `toml:"cameraFilePattern"`
+	cameraFileRegexp  *regexp.Regexp
+
+	// CameraFileTimeoutMs is how long to wait after stopping for a file from each expected camera
+	CameraFileTimeoutMs int `toml:"cameraFileTimeoutMs"`
+
+	// MinWidth, MinHeight and MinFps are the smallest OBS output resolution and frame rate accepted
+	// when connecting to OBS (0 to skip)
+	MinWidth  int     `toml:"minWidth"`
+	MinHeight int     `toml:"minHeight"`
+	MinFps    float64 `toml:"minFps"`
+
+	// ExpectedCameras are the camera numbers that must produce a file for each attempt, the cameraSources by default
+	ExpectedCameras []string `toml:"expectedCameras"`
+
+	// CameraSources maps camera numbers to the OBS source showing them, for previews
+	CameraSources map[string]string `toml:"cameraSources"`
+
+	// Warmup is a camera recorded continuously, independently of the attempts
+	Warmup WarmupRecording `toml:"warmup"`
+}
+
+// VerticalCrop describes how a camera's picture is cropped into a vertical video for social media
+type VerticalCrop struct {
+	OffsetX      float64 `toml:"offsetX"`      // shift of the crop center from the middle, as a fraction of the width (-0.5 to 0.5)
+	OffsetY      float64 `toml:"offsetY"`      // shift of the crop center from the middle, as a fraction of the height (-0.5 to 0.5)
+	Zoom         float64 `toml:"zoom"`         // 1 uses the full picture height, 2 crops half of it, default 1
+	OutputWidth  int     `toml:"outputWidth"`  // default 1080
+	OutputHeight int     `toml:"outputHeight"` // default 1920
+}
+
+// WarmupRecording describes a camera recorded continuously by ffmpeg into fixed-length files
+type WarmupRecording struct {
+	Input          string `toml:"input"`          // ffmpeg input, e.g. an RTSP URL or video="USB Camera" with dshow; disabled if empty
+	Format         string `toml:"format"`         // ffmpeg input format, e.g. dshow or v4l2
+	InputParams    string `toml:"inputParams"`    // additional ffmpeg input parameters
+	Params         string `toml:"params"`         // ffmpeg output parameters, streams are copied if empty
+	SegmentMinutes int    `toml:"segmentMinutes"` // length of each file, default 10
+	Dir            string `toml:"dir"`            // folder for the files, relative to videoDir, default warmup
+}
+
+// OBSClientSettings are the timeouts and retries of the connection to the OBS WebSocket
+type OBSClientSettings struct {
+	RequestTimeoutMs      int `toml:"requestTimeoutMs"`      // longest wait for the response to a request, default 10000
+	ReconnectMaxBackoffMs int `toml:"reconnectMaxBackoffMs"` // longest wait between reconnection attempts, default 30000
+	IdentifyTimeoutMs     int `toml:"identifyTimeoutMs"`     // longest wait for the Hello and Identified messages, default obsConnectTimeoutSeconds
+}
+
+// OBSPlatformSettings names the OBS scene collection and profile used for a platform
+type OBSPlatformSettings struct {
+	SceneCollection string `toml:"sceneCollection"`
+	Profile         string `toml:"profile"`
+}
+
+// OutputProfile describes an additional encoding of each replay, such as a small web copy
+type OutputProfile struct {
+	Name   string `toml:"name"`   // suffix added to the file name
+	Format string `toml:"format"` // file extension and container, default mp4
+	Scale  string `toml:"scale"`  // ffmpeg scale filter value, e.g. 1280:-2
+	Codec  string `toml:"codec"`  // video codec, e.g. libx264; streams are copied if empty and no scaling
+	Params string `toml:"params"` // additional ffmpeg output parameters
 }
 
 var (
 	Verbose       bool
 	NoVideo       bool
 	InstallDir    string
+	ConfigFile    string
+	Diagnose      bool
+	CheckOnly     bool
 	videoDir      string
 	Recode        bool
 	currentConfig *Config
@@ -41,9 +319,25 @@ func LoadConfig(configFile string) (*Config, error) {
 		return nil, fmt.Errorf("failed to extract default config: %w", err)
 	}
 
-	var config Config
+	// Defaults for values where zero is meaningful and cannot be used to detect an unset value
+	config := Config{
+		RecordStartTimeoutMs: 3000,
+		MaxRecordingSeconds:  600,
+		MaxClipSeconds:       300,
+		ClockOffsetWarningMs: 1000,
+		StatusHistorySize:    50,
+		IdleAfterSeconds:     10,
+		MaxConcurrentJobs:    1,
+		OBSSwitchSettings:    true,
+	}
 
-	if _, err := toml.DecodeFile(configFile, &config); err != nil {
+	meta, err := toml.DecodeFile(configFile, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Containers and services can override config.toml with OBSREPLAYS_<KEY> environment variables
+	if err := applyEnvOverrides(&config, meta); err != nil {
 		return nil, err
 	}
 
@@ -51,7 +345,15 @@ func LoadConfig(configFile string) (*Config, error) {
 	if config.VideoDir == "" {
 		config.VideoDir = "videos"
 	}
-	if !filepath.IsAbs(config.VideoDir) {
+	switch {
+	case isUNCPath(config.VideoDir):
+		// Network shares are used verbatim
+		logging.InfoLogger.Printf("Video directory is a network share: %s", config.VideoDir)
+	case !filepath.IsAbs(config.VideoDir):
+		if runtime.GOOS == "windows" && strings.HasPrefix(config.VideoDir, `\`) {
+			logging.WarningLogger.Printf("videoDir %q starts with a single backslash and is treated as relative. "+
+				"For a network share use single quotes in config.toml, e.g. videoDir = '\\\\server\\share\\videos'", config.VideoDir)
+		}
 		config.VideoDir = filepath.Join(GetInstallDir(), config.VideoDir)
 	}
 
@@ -59,22 +361,190 @@ func LoadConfig(configFile string) (*Config, error) {
 	if err := os.MkdirAll(config.VideoDir, os.ModePerm); err != nil {
 		return nil, fmt.Errorf("failed to create video directory: %w", err)
 	}
+	if err := checkWritable(config.VideoDir); err != nil {
+		return nil, fmt.Errorf("video directory %s is not writable: %w", config.VideoDir, err)
+	}
 
 	// Log the video directory
 	logging.InfoLogger.Printf("Videos will be stored in: %s", config.VideoDir)
 
+	// The archive is often on a NAS that may not be reachable yet, it is created when first used
+	if config.ArchiveDir != "" {
+		if !isUNCPath(config.ArchiveDir) && !filepath.IsAbs(config.ArchiveDir) {
+			config.ArchiveDir = filepath.Join(GetInstallDir(), config.ArchiveDir)
+		}
+		logging.InfoLogger.Printf("Videos will be archived to: %s", config.ArchiveDir)
+	}
+
+	// Default to the historical file name timestamp and make sure it is usable in file names
+	if config.TimestampLayout == "" {
+		config.TimestampLayout = DefaultTimestampLayout
+	}
+	if err := validateTimestampLayout(config.TimestampLayout); err != nil {
+		return nil, err
+	}
+
+	if config.Warmup.SegmentMinutes <= 0 {
+		config.Warmup.SegmentMinutes = 10
+	}
+	if config.Warmup.Dir == "" {
+		config.Warmup.Dir = "warmup"
+	}
+
+	if err := validateOBSWebSocket(&config); err != nil {
+		return nil, err
+	}
+
+	config.RecordingFormat = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(config.RecordingFormat), "."))
+	if config.RecordingFormat == "" {
+		config.RecordingFormat = DefaultRecordingFormat
+	}
+	if !regexp.MustCompile(`^[a-z0-9]+$`).MatchString(config.RecordingFormat) {
+		return nil, fmt.Errorf("recordingFormat %q is not a file extension such as flv or mp4", config.RecordingFormat)
+	}
+	if config.CameraFilePattern == "" {
+		config.CameraFilePattern = strings.Replace(DefaultCameraFilePattern, `\.flv$`, `\.`+config.RecordingFormat+`$`, 1)
+	}
+	re, err := regexp.Compile(config.CameraFilePattern)
+	if err != nil {
+		return nil, fmt.Errorf("cameraFilePattern %q is not a valid regular expression: %w", config.CameraFilePattern, err)
+	}
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("cameraFilePattern %q needs a group capturing the camera identifier", config.CameraFilePattern)
+	}
+	config.cameraFileRegexp = re
+
+	for _, params := range []struct {
+		key   string
+		value string
+		args  *[]string
+	}{
+		{"ffmpegGlobalParams", config.FfmpegGlobalParams, &config.ffmpegGlobalArgs},
+		{"ffmpegInputParams", config.FfmpegInputParams, &config.ffmpegInputArgs},
+		{"ffmpegOutputParams", config.FfmpegOutputParams, &config.ffmpegOutputArgs},
+	} {
+		if *params.args, err = SplitArgs(params.value); err != nil {
+			return nil, fmt.Errorf("%s: %w", params.key, err)
+		}
+	}
+
+	if config.StartHotkeys == nil {
+		config.StartHotkeys = []string{"OBS_KEY_F6", "OBS_KEY_F7"}
+	}
+	for _, key := range config.StartHotkeys {
+		if !strings.HasPrefix(key, "OBS_KEY_") {
+			return nil, fmt.Errorf("startHotkeys entry %q is not an OBS key name such as OBS_KEY_F7", key)
+		}
+	}
+
+	if config.CopyAttempts <= 0 {
+		config.CopyAttempts = 3
+	}
+	if config.CopyRetryDelayMs <= 0 {
+		config.CopyRetryDelayMs = 1000
+	}
+
+	if config.MaxRecordingSeconds < 0 {
+		return nil, fmt.Errorf("maxRecordingSeconds must not be negative, got %d", config.MaxRecordingSeconds)
+	}
+	if config.MaxClipSeconds < 0 {
+		return nil, fmt.Errorf("maxClipSeconds must not be negative, got %d", config.MaxClipSeconds)
+	}
+	if config.MinWidth < 0 || config.MinHeight < 0 || config.MinFps < 0 {
+		return nil, fmt.Errorf("minWidth, minHeight and minFps must not be negative")
+	}
+	if config.ClockOffsetWarningMs < 0 {
+		return nil, fmt.Errorf("clockOffsetWarningMs must not be negative, got %d", config.ClockOffsetWarningMs)
+	}
+
+	if config.PauseAfterMs <= 0 {
+		config.PauseAfterMs = 15000
+	}
+
+	if config.CameraFileTimeoutMs <= 0 {
+		config.CameraFileTimeoutMs = 5000
+	}
+
+	if config.IdleAfterSeconds < 0 {
+		return nil, fmt.Errorf("idleAfterSeconds must not be negative, got %d", config.IdleAfterSeconds)
+	}
+
+	if config.ReadyDebounceMs < 0 {
+		return nil, fmt.Errorf("readyDebounceMs must not be negative, got %d", config.ReadyDebounceMs)
+	}
+
+	if config.ReadyFlashMs <= 0 {
+		config.ReadyFlashMs = 2000
+	}
+
+	if config.HookTimeoutSeconds <= 0 {
+		config.HookTimeoutSeconds = 10
+	}
+
+	if config.LoudnessTarget != 0 && (config.LoudnessTarget < -70 || config.LoudnessTarget > -5) {
+		return nil, fmt.Errorf("loudnessTarget must be between -70 and -5 LUFS, got %g", config.LoudnessTarget)
+	}
+
+	if config.OutputFps < 0 || config.OutputFps > 240 {
+		return nil, fmt.Errorf("outputFps must be between 0 and 240, got %g", config.OutputFps)
+	}
+
+	if config.FixedDuration < 0 {
+		return nil, fmt.Errorf("fixedDuration must not be negative, got %d", config.FixedDuration)
+	}
+
+	switch config.SourceRetention {
+	case "":
+		config.SourceRetention = SourceDelete
+	case SourceDelete, SourceArchive, SourceKeep:
+	default:
+		return nil, fmt.Errorf("sourceRetention %q is not valid, expected %q, %q or %q",
+			config.SourceRetention, SourceDelete, SourceArchive, SourceKeep)
+	}
+
+	switch config.NoLiftAction {
+	case "":
+		config.NoLiftAction = NoLiftMove
+	case NoLiftMove, NoLiftDiscard:
+	default:
+		return nil, fmt.Errorf("noLiftAction %q is not valid, expected %q or %q",
+			config.NoLiftAction, NoLiftMove, NoLiftDiscard)
+	}
+
+	switch config.MissingTimerStop {
+	case "":
+		config.MissingTimerStop = MissingTimerStopDecision
+	case MissingTimerStopDecision, MissingTimerStopFull:
+	default:
+		return nil, fmt.Errorf("missingTimerStop %q is not valid, expected %q or %q",
+			config.MissingTimerStop, MissingTimerStopDecision, MissingTimerStopFull)
+	}
+
+	if err := validateQualityPreset(&config); err != nil {
+		return nil, err
+	}
+
+	if err := validateProfiles(config.Profiles); err != nil {
+		return nil, err
+	}
+	for camera, crop := range config.Vertical {
+		if crop.Zoom <= 0 {
+			crop.Zoom = 1
+		}
+		if crop.OutputWidth <= 0 {
+			crop.OutputWidth = 1080
+		}
+		if crop.OutputHeight <= 0 {
+			crop.OutputHeight = 1920
+		}
+		config.Vertical[camera] = crop
+	}
+
 	// Set remaining recording package configurations
 	SetVideoDir(config.VideoDir)
 
-	// Log all configuration parameters
-	platformKey := getPlatformName()
-	logging.InfoLogger.Printf("Configuration loaded from %s for platform %s:\n"+
-		"    Port: %d\n"+
-		"    VideoDir: %s\n",
-		configFile,
-		platformKey,
-		config.Port,
-		config.VideoDir)
+	// Log all configuration parameters, the first thing needed in a support case
+	logEffectiveConfig(&config, configFile, getPlatformName())
 
 	// Store the current config for later use
 	currentConfig = &config
@@ -82,6 +552,48 @@ func LoadConfig(configFile string) (*Config, error) {
 	return &config, nil
 }
 
+// isUNCPath reports whether path is a network share such as \\server\share\videos
+func isUNCPath(path string) bool {
+	return strings.HasPrefix(path, `\\`) || strings.HasPrefix(path, "//")
+}
+
+// checkWritable verifies that a file can be created in dir
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".obsreplays-write-test-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// validateProfiles checks that output profiles have unique names usable in file names, and defaults the format
+func validateProfiles(profiles []OutputProfile) error {
+	names := make(map[string]bool)
+	for i := range profiles {
+		profile := &profiles[i]
+		if profile.Name == "" {
+			return fmt.Errorf("output profile %d has no name", i+1)
+		}
+		if strings.ContainsAny(profile.Name, unsafeFileNameChars+" ") {
+			return fmt.Errorf("output profile name %q contains characters not allowed in file names", profile.Name)
+		}
+		if names[profile.Name] {
+			return fmt.Errorf("duplicate output profile name %q", profile.Name)
+		}
+		names[profile.Name] = true
+		if profile.Format == "" {
+			profile.Format = "mp4"
+		}
+	}
+	return nil
+}
+
+// CameraFileRegexp returns the compiled cameraFilePattern
+func (c *Config) CameraFileRegexp() *regexp.Regexp {
+	return c.cameraFileRegexp
+}
+
 // GetCurrentConfig returns the current configuration
 func GetCurrentConfig() *Config {
 	return currentConfig
@@ -90,15 +602,23 @@ func GetCurrentConfig() *Config {
 // InitConfig processes command-line flags and loads the configuration
 func InitConfig() (*Config, error) {
 	configFile := flag.String("config", filepath.Join(GetInstallDir(), "config.toml"), "path to configuration file")
-	flag.StringVar(&InstallDir, "dir", "obsreplays", fmt.Sprintf(
-		`Name of an alternate installation directory. Default is 'obsreplays'.
+	// The environment variable replaces the default, the flag still wins
+	defaultDir := "obsreplays"
+	if dir := os.Getenv(InstallDirEnv); dir != "" {
+		defaultDir = dir
+	}
+	flag.StringVar(&InstallDir, "dir", defaultDir, fmt.Sprintf(
+		`Name of an alternate installation directory. Default is 'obsreplays', or %s when set.
 Value is relative to the platform-specific directory for applcation data (%s)
 Used for multiple installations on the same machine (e.g. 'replays2, replay3').
-An absolute path can be provded if needed.`, GetInstallDir()))
+An absolute path can be provded if needed.`, InstallDirEnv, GetInstallDir()))
 	verbose := flag.Bool("v", false, "enable verbose logging")
 	verboseAlt := flag.Bool("verbose", false, "enable verbose logging")
 	flag.BoolVar(&NoVideo, "noVideo", false, "log ffmpeg actions but do not execute them")
+	flag.BoolVar(&Diagnose, "diagnose", false, "write a diagnostic report for support and exit")
+	flag.BoolVar(&CheckOnly, "checkConfig", false, "check the configuration, print the result of each check and exit (non-zero on failure)")
 	flag.Parse()
+	ConfigFile = *configFile
 
 	// Set verbose mode in logging package
 	logging.SetVerbose(*verbose || *verboseAlt)
@@ -117,19 +637,40 @@ An absolute path can be provded if needed.`, GetInstallDir()))
 		return nil, fmt.Errorf("error loading configuration: %w", err)
 	}
 
+	if cfg.SplitErrorLog {
+		if err := logging.EnableErrorLog(); err != nil {
+			return nil, fmt.Errorf("failed to initialize error log: %w", err)
+		}
+	}
+
 	return cfg, nil
 }
 
+// IsSecretKey reports whether a configuration key holds a value that must not appear in reports or logs
+func IsSecretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, word := range []string{"password", "secret", "token", "credential"} {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
 // getInstallDir returns the installation directory based on the environment
 func GetInstallDir() string {
-	if InstallDir != "" && filepath.IsAbs(InstallDir) {
-		return InstallDir
+	dir := InstallDir
+	if dir == "" {
+		dir = os.Getenv(InstallDirEnv)
+	}
+	if dir != "" && filepath.IsAbs(dir) {
+		return dir
 	}
 
 	var baseDir string
 	appName := "obsreplays"
-	if InstallDir != "" {
-		appName = InstallDir
+	if dir != "" {
+		appName = dir
 	}
 
 	switch runtime.GOOS {
@@ -183,10 +724,7 @@ func UpdateConfigFile(configFile, owlcmsAddress string) error {
 		if strings.HasPrefix(trimmed, "# owlcms =") ||
 			strings.HasPrefix(trimmed, "owlcms =") ||
 			trimmed == "# owlcms" {
-			address := owlcmsAddress
-			if strings.Contains(address, ":") {
-				address = strings.Split(address, ":")[0]
-			}
+			address := NormalizeOwlcmsAddress(owlcmsAddress)
 			leadingSpace := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
 			lines[i] = fmt.Sprintf("%sowlcms = \"%s\"", leadingSpace, address)
 			foundOwlcms = true
@@ -198,10 +736,7 @@ func UpdateConfigFile(configFile, owlcmsAddress string) error {
 	}
 
 	if !foundOwlcms && portLineIndex >= 0 {
-		address := owlcmsAddress
-		if strings.Contains(address, ":") {
-			address = strings.Split(address, ":")[0]
-		}
+		address := NormalizeOwlcmsAddress(owlcmsAddress)
 		leadingSpace := lines[portLineIndex][:len(lines[portLineIndex])-len(strings.TrimLeft(lines[portLineIndex], " \t"))]
 		newLine := fmt.Sprintf("%sowlcms = \"%s\"", leadingSpace, address)
 		lines = append(lines[:portLineIndex+1], append([]string{newLine}, lines[portLineIndex+1:]...)...)
@@ -267,3 +802,42 @@ func SetRecode(recode bool) {
 func GetVideoDir() string {
 	return videoDir
 }
+
+// validateOBSWebSocket checks the OBS WebSocket address and its TLS options
+func validateOBSWebSocket(config *Config) error {
+	if config.OBSWebSocketURL == "" {
+		config.OBSWebSocketURL = DefaultOBSWebSocketURL
+	}
+	u, err := url.Parse(config.OBSWebSocketURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("obsWebSocketUrl %q is not a valid URL such as ws://localhost:4444", config.OBSWebSocketURL)
+	}
+	switch u.Scheme {
+	case "wss":
+	case "ws":
+		if config.OBSTLSSkipVerify || config.OBSCAFile != "" {
+			return fmt.Errorf("obsTlsSkipVerify and obsCaFile require a wss:// obsWebSocketUrl, got %q", config.OBSWebSocketURL)
+		}
+	default:
+		return fmt.Errorf("obsWebSocketUrl %q must start with ws:// or wss://", config.OBSWebSocketURL)
+	}
+	if config.OBSCAFile != "" {
+		if _, err := os.Stat(config.OBSCAFile); err != nil {
+			return fmt.Errorf("obsCaFile: %w", err)
+		}
+	}
+
+	if config.OBSConnectTimeoutSeconds <= 0 {
+		config.OBSConnectTimeoutSeconds = 5
+	}
+	if config.OBS.RequestTimeoutMs <= 0 {
+		config.OBS.RequestTimeoutMs = 10000
+	}
+	if config.OBS.ReconnectMaxBackoffMs <= 0 {
+		config.OBS.ReconnectMaxBackoffMs = 30000
+	}
+	if config.OBS.IdentifyTimeoutMs <= 0 {
+		config.OBS.IdentifyTimeoutMs = config.OBSConnectTimeoutSeconds * 1000
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// EnvPrefix starts the environment variables overriding config.toml, the rest of the name is the
+// key in upper case: OBSREPLAYS_PORT, OBSREPLAYS_OWLCMS, OBSREPLAYS_VIDEODIR...
+const EnvPrefix = "OBSREPLAYS_"
+
+// applyEnvOverrides replaces the top-level values that have an environment variable and logs where
+// each value that is not a default comes from. Values are defaults < config.toml < environment.
+func applyEnvOverrides(config *Config, meta toml.MetaData) error {
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		field := v.Field(i)
+
+		source := ""
+		if meta.IsDefined(key) {
+			source = "config.toml"
+		}
+		if value, ok := os.LookupEnv(EnvPrefix + strings.ToUpper(key)); ok {
+			if err := setFromEnv(field, value); err != nil {
+				return fmt.Errorf("%s%s: %w", EnvPrefix, strings.ToUpper(key), err)
+			}
+			source = "environment"
+		}
+		if source == "" {
+			continue
+		}
+
+		shown := fmt.Sprint(field.Interface())
+		if IsSecretKey(key) {
+			shown = "****"
+		}
+		logging.InfoLogger.Printf("Config %s = %s (from %s)", key, shown, source)
+	}
+	return nil
+}
+
+// setFromEnv parses an environment variable into a configuration value, lists are comma-separated
+func setFromEnv(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("cannot be set from the environment, use config.toml")
+		}
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("cannot be set from the environment, use config.toml")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// DefaultMQTTPort is the port of the owlcms MQTT broker when the owlcms address does not include one
+const DefaultMQTTPort = "1883"
+
+// splitOwlcmsAddress returns the host and the port (empty if none) of an owlcms address.  The address
+// can be a hostname, an IPv4 literal or an IPv6 literal with or without brackets, optionally followed
+// by a port, or a URL such as tcp://[fe80::1]:1883
+func splitOwlcmsAddress(address string) (string, string) {
+	address = strings.TrimSpace(address)
+	if strings.Contains(address, "://") {
+		if u, err := url.Parse(address); err == nil && u.Host != "" {
+			return u.Hostname(), u.Port()
+		}
+	}
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		return host, port
+	}
+	// No port: strip the brackets an IPv6 literal may have
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), ""
+}
+
+// BrokerAddress returns the host:port of the owlcms MQTT broker, adding the default port if none is configured
+func BrokerAddress(owlcms string) string {
+	host, port := splitOwlcmsAddress(owlcms)
+	if port == "" {
+		port = DefaultMQTTPort
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// NormalizeOwlcmsAddress removes the port from an owlcms address when it is the default one,
+// and keeps explicit non-default ports
+func NormalizeOwlcmsAddress(address string) string {
+	host, port := splitOwlcmsAddress(address)
+	if port == "" || port == DefaultMQTTPort {
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// DefaultOwlcmsWebPort is the port of the owlcms web server
+const DefaultOwlcmsWebPort = "8080"
+
+// OwlcmsWebURL returns the URL of the owlcms web server, owlcmsUrl if configured
+func OwlcmsWebURL(cfg *Config) string {
+	if cfg.OwlcmsURL != "" {
+		return cfg.OwlcmsURL
+	}
+	host, _ := splitOwlcmsAddress(cfg.OwlCMS)
+	if host == "" {
+		return ""
+	}
+	return "http://" + net.JoinHostPort(host, DefaultOwlcmsWebPort) + "/"
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// qualityPresets maps the qualityPreset names to the ffmpeg encoding options used when recoding.
+// CRF gives a variable bitrate at constant quality, maxrate caps it for players with limited bandwidth.
+var qualityPresets = map[string][]string{
+	// High quality H.264 for broadcast playout, large files
+	"broadcast": {"-c:v", "libx264", "-preset", "slow", "-crf", "18", "-maxrate", "20M", "-bufsize", "40M",
+		"-pix_fmt", "yuv420p", "-c:a", "aac", "-b:a", "192k"},
+	// Small files that start playing quickly in a browser
+	"web": {"-c:v", "libx264", "-preset", "veryfast", "-crf", "23", "-maxrate", "5M", "-bufsize", "10M",
+		"-pix_fmt", "yuv420p", "-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart"},
+	// Near lossless for keeping, without a bitrate cap
+	"archive": {"-c:v", "libx264", "-preset", "slow", "-crf", "14",
+		"-pix_fmt", "yuv420p", "-c:a", "aac", "-b:a", "256k"},
+}
+
+// QualityPresetNames returns the valid qualityPreset values, sorted
+func QualityPresetNames() []string {
+	names := make([]string, 0, len(qualityPresets))
+	for name := range qualityPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateQualityPreset checks that qualityPreset is empty or a known preset name
+func validateQualityPreset(config *Config) error {
+	config.QualityPreset = strings.ToLower(strings.TrimSpace(config.QualityPreset))
+	if config.QualityPreset == "" {
+		return nil
+	}
+	if _, ok := qualityPresets[config.QualityPreset]; !ok {
+		return fmt.Errorf("qualityPreset %q is not valid, expected one of %s",
+			config.QualityPreset, strings.Join(QualityPresetNames(), ", "))
+	}
+	return nil
+}
+
+// QualityArgs returns the ffmpeg encoding options of the qualityPreset, nil if none is set
+func (c *Config) QualityArgs() []string {
+	args := qualityPresets[c.QualityPreset]
+	if args == nil {
+		return nil
+	}
+	return append([]string(nil), args...)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// logEffectiveConfig logs every configuration value once defaults, config.toml and environment
+// overrides are applied, as keys of config.toml. Secrets are masked. Tables such as profiles and
+// camera settings are only listed in verbose mode.
+func logEffectiveConfig(config *Config, configFile, platform string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Effective configuration from %s for platform %s:\n", configFile, platform)
+	fmt.Fprintf(&b, "    installDir = %q\n", GetInstallDir())
+
+	v := reflect.ValueOf(config).Elem()
+	t := v.Type()
+	hidden := 0
+	for i := 0; i < t.NumField(); i++ {
+		key := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		field := v.Field(i)
+		if isTable(field.Type()) && !logging.Verbose {
+			hidden++
+			continue
+		}
+		fmt.Fprintf(&b, "    %s = %s\n", key, formatConfigValue(key, field))
+	}
+	if hidden > 0 {
+		fmt.Fprintf(&b, "    (%d tables such as profiles and camera settings are listed with -v)\n", hidden)
+	}
+	logging.InfoLogger.Print(b.String())
+}
+
+// isTable reports whether a configuration value is a TOML table or array of tables
+func isTable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.Struct
+	}
+	return false
+}
+
+// formatConfigValue shows a configuration value, masking secrets that are set
+func formatConfigValue(key string, field reflect.Value) string {
+	if IsSecretKey(key) && !field.IsZero() {
+		return "****"
+	}
+	switch field.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", field.String())
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		return fmt.Sprintf("%+v", field.Interface())
+	}
+	return fmt.Sprint(field.Interface())
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultTimestampLayout is the layout historically used to prefix replay file names
+const DefaultTimestampLayout = "2006-01-02_15h04m05s"
+
+// characters that are not allowed in file names on at least one supported platform
+const unsafeFileNameChars = `<>:"/\|?*`
+
+// validateTimestampLayout checks that the layout produces a non-empty, filesystem-safe string
+func validateTimestampLayout(layout string) error {
+	sample := time.Date(2024, time.December, 31, 23, 59, 58, 999000000, time.UTC).Format(layout)
+	if strings.TrimSpace(sample) == "" {
+		return fmt.Errorf("timestampLayout %q produces an empty timestamp", layout)
+	}
+	if strings.ContainsAny(sample, unsafeFileNameChars) {
+		return fmt.Errorf("timestampLayout %q produces %q, which contains characters not allowed in file names (%s)", layout, sample, unsafeFileNameChars)
+	}
+	for _, r := range sample {
+		if r < 32 {
+			return fmt.Errorf("timestampLayout %q produces control characters", layout)
+		}
+	}
+	return nil
+}
+
+// timestampSettings returns the effective layout and location for file name timestamps
+func timestampSettings() (string, *time.Location) {
+	if currentConfig == nil || currentConfig.TimestampLayout == "" {
+		return DefaultTimestampLayout, time.Local
+	}
+	if currentConfig.TimestampUTC {
+		return currentConfig.TimestampLayout, time.UTC
+	}
+	return currentConfig.TimestampLayout, time.Local
+}
+
+// FormatTimestamp formats t for use in a replay file name, using the configured layout and timezone
+func FormatTimestamp(t time.Time) string {
+	layout, loc := timestampSettings()
+	return t.In(loc).Format(layout)
+}
+
+// ParseTimestamp parses a timestamp produced by FormatTimestamp
+func ParseTimestamp(value string) (time.Time, error) {
+	layout, loc := timestampSettings()
+	return time.ParseInLocation(layout, value, loc)
+}
+
+// timestampTokens are the elements of a time layout with the text they produce, longest first so that
+// e.g. 2006 is not taken for 2 followed by literal text
+var timestampTokens = []struct{ layout, pattern string }{
+	{"January", `[A-Za-z]+`}, {"Monday", `[A-Za-z]+`}, {"Jan", `[A-Za-z]+`}, {"Mon", `[A-Za-z]+`},
+	{"MST", `(?:[A-Za-z]+|[+-][0-9]+)`},
+	{"Z07:00:00", `(?:Z|[+-][0-9:]+)`}, {"Z070000", `(?:Z|[+-][0-9]+)`}, {"Z07:00", `(?:Z|[+-][0-9:]+)`},
+	{"Z0700", `(?:Z|[+-][0-9]+)`}, {"Z07", `(?:Z|[+-][0-9]+)`},
+	{"-07:00:00", `[+-][0-9:]+`}, {"-070000", `[+-][0-9]+`}, {"-07:00", `[+-][0-9:]+`}, {"-0700", `[+-][0-9]+`},
+	{"-07", `[+-][0-9]+`},
+	{"2006", `[0-9]+`}, {"__2", `[ 0-9]+`}, {"002", `[0-9]+`}, {"_2", `[ 0-9]+`},
+	{"01", `[0-9]+`}, {"02", `[0-9]+`}, {"03", `[0-9]+`}, {"04", `[0-9]+`}, {"05", `[0-9]+`}, {"06", `[0-9]+`},
+	{"15", `[0-9]+`}, {"1", `[0-9]+`}, {"2", `[0-9]+`}, {"3", `[0-9]+`}, {"4", `[0-9]+`}, {"5", `[0-9]+`},
+	{"PM", `[AaPp][Mm]`}, {"pm", `[AaPp][Mm]`},
+}
+
+// timestampPattern returns a regular expression matching the timestamps produced by layout
+func timestampPattern(layout string) string {
+	var pattern strings.Builder
+	for i := 0; i < len(layout); {
+		// Fractional seconds, .999 drops trailing zeros and may produce nothing
+		if c := layout[i]; (c == '.' || c == ',') && i+1 < len(layout) && (layout[i+1] == '0' || layout[i+1] == '9') {
+			j := i + 1
+			for j < len(layout) && layout[j] == layout[i+1] {
+				j++
+			}
+			if j == len(layout) || layout[j] < '0' || layout[j] > '9' {
+				pattern.WriteString(`(?:[.,][0-9]+)?`)
+				i = j
+				continue
+			}
+		}
+		matched := false
+		for _, token := range timestampTokens {
+			if !strings.HasPrefix(layout[i:], token.layout) {
+				continue
+			}
+			// _2006 is an underscore followed by the year, as in the time package
+			if token.layout == "_2" && strings.HasPrefix(layout[i+1:], "2006") {
+				continue
+			}
+			pattern.WriteString(token.pattern)
+			i += len(token.layout)
+			matched = true
+			break
+		}
+		if !matched {
+			pattern.WriteString(regexp.QuoteMeta(layout[i : i+1]))
+			i++
+		}
+	}
+	return pattern.String()
+}
+
+// TimestampNameRegexp matches a replay file base name made of a timestamp in the configured layout,
+// an underscore and the rest of the name, captured as the first and second groups
+func TimestampNameRegexp() *regexp.Regexp {
+	layout, _ := timestampSettings()
+	return regexp.MustCompile(`^(` + timestampPattern(layout) + `)_(.+)$`)
+}
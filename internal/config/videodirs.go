@@ -0,0 +1,192 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+// DateDirLayout names the top-level day folders of the videos directory when datePrefix is set
+const DateDirLayout = "2006-01-02"
+
+const (
+	// WindowsMaxPath is the longest path Windows accepts without long path support (MAX_PATH minus the NUL)
+	WindowsMaxPath = 259
+	// unixMaxPath is PATH_MAX minus the NUL
+	unixMaxPath = 4095
+	// MaxNameLength is the longest file or directory name on common filesystems
+	MaxNameLength = 255
+	// replayNameRoom is kept in replay paths after the session folder, for a lift type folder and a
+	// file name with its timestamp, a recognizable part of the athlete name and the camera suffix
+	replayNameRoom = 100
+)
+
+// PathLimit returns the longest path allowed on this platform
+func PathLimit() int {
+	if runtime.GOOS == "windows" {
+		return WindowsMaxPath
+	}
+	return unixMaxPath
+}
+
+// ShortenName cuts s to at most n bytes, replacing its end by a hash of the whole string so that
+// different long strings remain different
+func ShortenName(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	tag := fmt.Sprintf("~%08x", h.Sum32())
+
+	keep := n - len(tag)
+	if keep < 0 {
+		keep = 0
+	}
+	for keep > 0 && !utf8.RuneStart(s[keep]) {
+		keep--
+	}
+	return s[:keep] + tag
+}
+
+// SessionDirName returns the folder of a session in the folder of the day, "unsorted" without a
+// session. Replays are filed, listed and reassigned under this name.
+func SessionDirName(session string) string {
+	name, _ := FitSessionName(DatedVideoDir(time.Now()), session, PathLimit())
+	return name
+}
+
+// FitSessionName returns the folder of a session in parentDir, shortened when it would not leave
+// room for the replay files within limit characters. shortened reports when this happened.
+func FitSessionName(parentDir, session string, limit int) (name string, shortened bool) {
+	name = strings.ReplaceAll(strings.TrimSpace(session), " ", "_")
+	if name == "" {
+		return "unsorted", false
+	}
+	room := limit - len(parentDir) - 1 - replayNameRoom
+	if room > MaxNameLength {
+		room = MaxNameLength
+	}
+	if len(name) <= room {
+		return name, false
+	}
+	return ShortenName(name, room), true
+}
+
+// DateDir returns the day folder for replays recorded at t, or "" when datePrefix is not set
+func DateDir(t time.Time) string {
+	if currentConfig == nil || !currentConfig.DatePrefix {
+		return ""
+	}
+	_, loc := timestampSettings()
+	return t.In(loc).Format(DateDirLayout)
+}
+
+// DatedVideoDir returns the directory holding the session folders for replays recorded at t
+func DatedVideoDir(t time.Time) string {
+	return filepath.Join(GetVideoDir(), DateDir(t))
+}
+
+// SessionDirs lists the session folders of the videos directory, relative to it with forward
+// slashes. Folders inside day folders are listed as day/session, folders created before
+// datePrefix was set are still listed.
+func SessionDirs() ([]string, error) {
+	entries, err := os.ReadDir(GetVideoDir())
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(DateDirLayout, entry.Name()); err != nil {
+			dirs = append(dirs, entry.Name())
+			continue
+		}
+		sessions, err := os.ReadDir(filepath.Join(GetVideoDir(), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range sessions {
+			if session.IsDir() {
+				dirs = append(dirs, entry.Name()+"/"+session.Name())
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// LiftTypes are the lift types sent by owlcms, in competition order
+var LiftTypes = []string{"SNATCH", "CLEANJERK"}
+
+var unsafeDirChars = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// LiftTypeDir returns the folder of a session holding the replays of a lift type when
+// liftTypeFolders is set, a lower case name safe on every file system
+func LiftTypeDir(liftType string) string {
+	dir := strings.Trim(unsafeDirChars.ReplaceAllString(strings.ToLower(liftType), "_"), "_")
+	if dir == "" {
+		return "other"
+	}
+	return dir
+}
+
+// ReplayDirs returns the folders holding the replays of a session, relative to the videos
+// directory with forward slashes: the session folder followed by its lift type folders. Lift type
+// folders are listed whenever they exist, so that changing liftTypeFolders hides no replays.
+func ReplayDirs(session string) []string {
+	dirs := []string{session}
+	for _, liftType := range LiftTypes {
+		dir := path.Join(session, LiftTypeDir(liftType))
+		if info, err := os.Stat(filepath.Join(GetVideoDir(), filepath.FromSlash(dir))); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// SessionReplay is a replay manifest with the folder holding its files, relative to the videos
+// directory with forward slashes
+type SessionReplay struct {
+	Dir      string
+	Manifest types.ReplayManifest
+}
+
+// SessionReplays reads the manifests of a session directory, relative to the videos directory, and
+// of its lift type folders, oldest first. Invalid manifests are skipped.
+func SessionReplays(session string) ([]SessionReplay, error) {
+	var replays []SessionReplay
+	for _, dir := range ReplayDirs(session) {
+		manifestFiles, err := filepath.Glob(filepath.Join(GetVideoDir(), filepath.FromSlash(dir), "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, manifestFile := range manifestFiles {
+			data, err := os.ReadFile(manifestFile)
+			if err != nil {
+				return nil, err
+			}
+			var manifest types.ReplayManifest
+			if err := json.Unmarshal(data, &manifest); err != nil {
+				logging.WarningLogger.Printf("Skipping invalid replay manifest %s: %v", manifestFile, err)
+				continue
+			}
+			replays = append(replays, SessionReplay{Dir: dir, Manifest: manifest})
+		}
+	}
+	sort.SliceStable(replays, func(i, j int) bool { return replays[i].Manifest.Created.Before(replays[j].Manifest.Created) })
+	return replays, nil
+}
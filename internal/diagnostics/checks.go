@@ -0,0 +1,132 @@
+package diagnostics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/recording"
+)
+
+// errSkipped marks a check that does not apply to the current configuration
+var errSkipped = errors.New("skipped")
+
+// check is a single pre-flight verification
+type check struct {
+	name string
+	run  func(cfg *config.Config) error
+}
+
+var checks = []check{
+	{"HTTP port", checkPort},
+	{"owlcms reachable", checkOwlcms},
+	{"ffmpeg", checkFfmpeg},
+	{"captures directory", func(*config.Config) error { return checkDir(recording.GetCaptureDir()) }},
+	{"videos directory", func(*config.Config) error {
+		if err := recording.CheckVideoDir(); err != nil {
+			return err
+		}
+		return checkDir(config.GetVideoDir())
+	}},
+	{"camera settings", checkCameras},
+	{"OBS connection", func(*config.Config) error { return recording.TestOBSConnection() }},
+}
+
+// CheckConfig runs the pre-flight checks against a loaded configuration, prints one line per
+// check to w, and reports whether all of them passed
+func CheckConfig(cfg *config.Config, w io.Writer) bool {
+	ok := true
+	for _, c := range checks {
+		err := c.run(cfg)
+		switch {
+		case err == errSkipped:
+			fmt.Fprintf(w, "SKIP  %s\n", c.name)
+		case err != nil:
+			fmt.Fprintf(w, "FAIL  %s: %v\n", c.name, err)
+			ok = false
+		default:
+			fmt.Fprintf(w, "PASS  %s\n", c.name)
+		}
+	}
+	return ok
+}
+
+// checkPort verifies the HTTP port is valid and not used by another program
+func checkPort(cfg *config.Config) error {
+	if cfg.Port < 1 || cfg.Port > 65535 {
+		return fmt.Errorf("port %d is out of range 1-65535", cfg.Port)
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		return fmt.Errorf("port %d is not available: %w", cfg.Port, err)
+	}
+	return l.Close()
+}
+
+// checkOwlcms connects to the MQTT broker carrying owlcms events, when an address is configured
+func checkOwlcms(cfg *config.Config) error {
+	address := config.BrokerAddress(cfg.OwlCMS)
+	if cfg.MQTTBroker != "" {
+		u, err := url.Parse(cfg.MQTTBroker)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("mqttBroker %q is not a valid URL", cfg.MQTTBroker)
+		}
+		address = u.Host
+	} else if cfg.OwlCMS == "" {
+		// The network will be scanned at startup
+		return errSkipped
+	}
+	conn, err := net.DialTimeout("tcp", address, 3*time.Second)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %s: %w", address, err)
+	}
+	return conn.Close()
+}
+
+// checkFfmpeg verifies that ffmpeg can be run
+func checkFfmpeg(*config.Config) error {
+	path, _, err := recording.FfmpegVersion()
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// checkDir verifies that a directory exists and is writable
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".obsreplays-write-test-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkCameras verifies that per-camera settings name a camera number and stay within the picture
+func checkCameras(cfg *config.Config) error {
+	for camera, crop := range cfg.Vertical {
+		if n, err := strconv.Atoi(camera); err != nil || n < 1 {
+			return fmt.Errorf("vertical.%s: camera must be a number starting at 1", camera)
+		}
+		if crop.OffsetX < -0.5 || crop.OffsetX > 0.5 || crop.OffsetY < -0.5 || crop.OffsetY > 0.5 {
+			return fmt.Errorf("vertical.%s: offsets must be between -0.5 and 0.5", camera)
+		}
+		if crop.OutputWidth%2 != 0 || crop.OutputHeight%2 != 0 {
+			return fmt.Errorf("vertical.%s: output width and height must be even", camera)
+		}
+	}
+	return nil
+}
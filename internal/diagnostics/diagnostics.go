@@ -0,0 +1,141 @@
+// Package diagnostics produces a single report with the information usually requested in support cases
+package diagnostics
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/recording"
+)
+
+// logLines is the number of trailing log lines included in the report
+const logLines = 200
+
+// WriteReport writes the diagnostic report to the logs directory and returns its path
+func WriteReport() (string, error) {
+	var b strings.Builder
+
+	section(&b, "Application")
+	fmt.Fprintf(&b, "Version: %s\n", config.GetProgramVersion())
+	fmt.Fprintf(&b, "Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&b, "Install directory: %s\n", config.GetInstallDir())
+	fmt.Fprintf(&b, "Report time: %s\n", time.Now().Format(time.RFC3339))
+
+	section(&b, "Configuration")
+	fmt.Fprintf(&b, "Config file: %s\n\n", config.ConfigFile)
+	if content, err := os.ReadFile(config.ConfigFile); err != nil {
+		fmt.Fprintf(&b, "Cannot read config file: %v\n", err)
+	} else {
+		b.WriteString(redact(string(content)))
+		b.WriteString("\n")
+	}
+
+	section(&b, "ffmpeg")
+	path, version, err := recording.FfmpegVersion()
+	fmt.Fprintf(&b, "Path: %s\n", path)
+	if err != nil {
+		fmt.Fprintf(&b, "Error: %v\n", err)
+	} else {
+		fmt.Fprintf(&b, "Version: %s\n", version)
+	}
+
+	section(&b, "OBS")
+	if err := recording.TestOBSConnection(); err != nil {
+		fmt.Fprintf(&b, "Connection: FAILED - %v\n", err)
+	} else {
+		b.WriteString("Connection: OK\n")
+	}
+
+	section(&b, "Directories")
+	describeDir(&b, "Captures", recording.GetCaptureDir())
+	describeDir(&b, "Videos", config.GetVideoDir())
+
+	section(&b, fmt.Sprintf("Last %d log lines", logLines))
+	b.WriteString(tailLog(logging.GetLogFilePath(), logLines))
+
+	reportPath := filepath.Join(config.GetInstallDir(), "logs",
+		fmt.Sprintf("diagnostics_%s.txt", time.Now().Format("2006-01-02_15h04m05s")))
+	if err := os.MkdirAll(filepath.Dir(reportPath), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(reportPath, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return reportPath, nil
+}
+
+// section writes a section header
+func section(b *strings.Builder, title string) {
+	fmt.Fprintf(b, "\n=== %s ===\n", title)
+}
+
+// redact hides the values of secret configuration keys
+func redact(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		key, _, found := strings.Cut(line, "=")
+		if found && config.IsSecretKey(key) {
+			lines[i] = strings.TrimRight(key, " \t") + " = \"<redacted>\""
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describeDir reports whether a directory exists, is writable, and how much space is free
+func describeDir(b *strings.Builder, label, dir string) {
+	fmt.Fprintf(b, "%s directory: %s\n", label, dir)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		fmt.Fprintf(b, "    Exists: no (%v)\n", err)
+		return
+	}
+	if !info.IsDir() {
+		b.WriteString("    Exists: yes, but is not a directory\n")
+		return
+	}
+	b.WriteString("    Exists: yes\n")
+
+	if f, err := os.CreateTemp(dir, ".obsreplays-write-test-*"); err != nil {
+		fmt.Fprintf(b, "    Writable: no (%v)\n", err)
+	} else {
+		f.Close()
+		os.Remove(f.Name())
+		b.WriteString("    Writable: yes\n")
+	}
+
+	if free, err := freeSpace(dir); err != nil {
+		fmt.Fprintf(b, "    Free space: unknown (%v)\n", err)
+	} else {
+		fmt.Fprintf(b, "    Free space: %.1f GB\n", float64(free)/(1<<30))
+	}
+}
+
+// tailLog returns the last n lines of the log file
+func tailLog(path string, n int) string {
+	if path == "" {
+		return "No log file\n"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Sprintf("Cannot read log file %s: %v\n", path, err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,14 @@
+package diagnostics
+
+import (
+	"syscall"
+)
+
+// freeSpace returns the number of bytes available to the current user on the volume holding dir
+func freeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
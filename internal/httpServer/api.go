@@ -0,0 +1,303 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+var (
+	// ForceStopFunc is registered by the application to force-stop OBS recordings
+	ForceStopFunc func() error
+	// PreviewFunc is registered by the application to get a JPEG snapshot of a camera
+	PreviewFunc func(camera string) ([]byte, error)
+	// ResetFunc is registered by the application to bring the recorder back to idle
+	ResetFunc func() error
+	// ReassignFunc is registered by the application to move unsorted replays into a session
+	ReassignFunc func(clips []string, from, to time.Time, session string) ([]string, error)
+	// CurrentRecordingFunc is registered by the application to describe the recording in progress
+	CurrentRecordingFunc func() CurrentRecording
+	// HighlightsFunc is registered by the application to start exporting the highlight reel of a session
+	HighlightsFunc func(session, camera string) (string, error)
+	// DeriveFunc is registered by the application to make the configured derived videos of a session
+	DeriveFunc func(session string) (int, error)
+)
+
+// CurrentRecording is the response of GET /api/recording/current, with only Recording false when idle
+type CurrentRecording struct {
+	Recording      bool       `json:"recording"`
+	Athlete        string     `json:"athlete,omitempty"`
+	LiftType       string     `json:"liftType,omitempty"`
+	Attempt        int        `json:"attempt,omitempty"`
+	Session        string     `json:"session,omitempty"`
+	Started        *time.Time `json:"started,omitempty"`
+	ElapsedSeconds float64    `json:"elapsedSeconds,omitempty"`
+	Paused         bool       `json:"paused,omitempty"`
+}
+
+// writeJSON writes v as a JSON response with the given HTTP status
+func writeJSON(w http.ResponseWriter, httpStatus int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.ErrorLogger.Printf("Failed to write JSON response: %v", err)
+	}
+}
+
+// currentStatus returns the last status sent to clients
+func currentStatus() StatusMessage {
+	mu.Lock()
+	defer mu.Unlock()
+	return StatusMessage{Code: statusCode, Text: statusMsg, Session: state.CurrentSession, Time: statusTime}
+}
+
+// forceStopHandler force-stops OBS recordings when OBS is stuck recording
+func forceStopHandler(w http.ResponseWriter, r *http.Request) {
+	if ForceStopFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	logging.InfoLogger.Printf("Force stop requested from %s", r.RemoteAddr)
+	if err := ForceStopFunc(); err != nil {
+		SendStatus(Error, fmt.Sprintf("Error: force stop failed - %v", err))
+		writeJSON(w, http.StatusInternalServerError, currentStatus())
+		return
+	}
+
+	// Clear the stop guard so the next attempt records its own timer stop
+	state.StopRequestCount = 0
+
+	SendStatus(Ready, "Recording force-stopped")
+	writeJSON(w, http.StatusOK, currentStatus())
+}
+
+// resetHandler brings the recorder back to idle when it is stuck, without restarting the application
+func resetHandler(w http.ResponseWriter, r *http.Request) {
+	if ResetFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+
+	logging.InfoLogger.Printf("Reset requested from %s", r.RemoteAddr)
+	if err := ResetFunc(); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"error": err.Error(), "status": currentStatus()})
+		return
+	}
+	writeJSON(w, http.StatusOK, currentStatus())
+}
+
+// bookmarkRequest optionally gives the bookmarked moment, in milliseconds from the start of the attempt
+type bookmarkRequest struct {
+	OffsetMs *int64 `json:"offsetMs"`
+}
+
+// bookmarkHandler marks a moment of the current recording, such as the lockout, as a chapter of the replay
+func bookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	var req bookmarkRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid bookmark: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	offset := int64(-1)
+	if req.OffsetMs != nil {
+		if *req.OffsetMs < 0 {
+			http.Error(w, "offsetMs must not be negative", http.StatusBadRequest)
+			return
+		}
+		offset = *req.OffsetMs
+	}
+
+	offset, err := state.AddBookmark(offset)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	logging.InfoLogger.Printf("Bookmark at %d ms added from %s", offset, r.RemoteAddr)
+	writeJSON(w, http.StatusOK, map[string]int64{"offsetMs": offset})
+}
+
+// previewHandler returns a snapshot of a camera so its framing can be checked from the web UI
+func previewHandler(w http.ResponseWriter, r *http.Request) {
+	if PreviewFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	image, err := PreviewFunc(mux.Vars(r)["camera"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(image)
+}
+
+// currentRecordingHandler describes the recording in progress, for dashboards
+func currentRecordingHandler(w http.ResponseWriter, r *http.Request) {
+	if CurrentRecordingFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusOK, CurrentRecordingFunc())
+}
+
+// ReplayFile is a video of a replay with the URL to play it
+type ReplayFile struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// LatestReplay is the most recently finalized replay
+type LatestReplay struct {
+	types.ReplayManifest
+	Files []ReplayFile `json:"files"` // replaces the file names of the manifest
+}
+
+// findLatestManifest returns the path of the most recently written replay manifest in the session directories
+func findLatestManifest() (string, error) {
+	sessions, err := config.SessionDirs()
+	if err != nil {
+		return "", err
+	}
+	var latest string
+	var latestTime time.Time
+	for _, session := range sessions {
+		for _, dir := range config.ReplayDirs(session) {
+			manifests, err := filepath.Glob(filepath.Join(config.GetVideoDir(), filepath.FromSlash(dir), "*.json"))
+			if err != nil {
+				continue
+			}
+			for _, manifest := range manifests {
+				info, err := os.Stat(manifest)
+				if err == nil && info.ModTime().After(latestTime) {
+					latest, latestTime = manifest, info.ModTime()
+				}
+			}
+		}
+	}
+	return latest, nil
+}
+
+// latestReplayHandler returns the most recently finalized replay, for screens that only show the last lift
+func latestReplayHandler(w http.ResponseWriter, r *http.Request) {
+	manifestFile, err := findLatestManifest()
+	if err != nil {
+		http.Error(w, "Failed to read videos directory", http.StatusInternalServerError)
+		return
+	}
+	if manifestFile == "" {
+		http.Error(w, "No replay available", http.StatusNotFound)
+		return
+	}
+
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		http.Error(w, "Failed to read replay manifest", http.StatusInternalServerError)
+		return
+	}
+	var replay LatestReplay
+	if err := json.Unmarshal(data, &replay.ReplayManifest); err != nil {
+		http.Error(w, "Invalid replay manifest", http.StatusInternalServerError)
+		return
+	}
+
+	// The session directory may be inside a day folder
+	sessionDir, err := filepath.Rel(config.GetVideoDir(), filepath.Dir(manifestFile))
+	if err != nil {
+		http.Error(w, "Failed to locate replay", http.StatusInternalServerError)
+		return
+	}
+	replay.Files = replayFiles(filepath.ToSlash(sessionDir), replay.ReplayManifest.Files)
+	writeJSON(w, http.StatusOK, replay)
+}
+
+// replayFiles returns the files of a replay in a session directory with the URLs to play them
+func replayFiles(sessionDir string, names []string) []ReplayFile {
+	var prefix string
+	for _, part := range strings.Split(sessionDir, "/") {
+		prefix += url.PathEscape(part) + "/"
+	}
+	files := make([]ReplayFile, 0, len(names))
+	for _, name := range names {
+		files = append(files, ReplayFile{
+			Name: name,
+			URL:  "/videos/" + prefix + url.PathEscape(name),
+		})
+	}
+	return files
+}
+
+// validSessionDir reports whether a session directory from a request stays inside the videos directory
+func validSessionDir(session string) bool {
+	for _, part := range strings.Split(session, "/") {
+		if part == ".." || strings.Contains(part, `\`) {
+			return false
+		}
+	}
+	return true
+}
+
+// reassignRequest selects unsorted replays by base name, or by recording time when no names are given
+type reassignRequest struct {
+	Clips   []string  `json:"clips"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Session string    `json:"session"`
+}
+
+// reassignHandler moves replays recorded before the session was known into the session directory
+func reassignHandler(w http.ResponseWriter, r *http.Request) {
+	if ReassignFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	var req reassignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Session == "" {
+		http.Error(w, "session is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Clips) == 0 && req.From.IsZero() && req.To.IsZero() {
+		http.Error(w, "clips or a time window (from, to) is required", http.StatusBadRequest)
+		return
+	}
+
+	logging.InfoLogger.Printf("Reassigning unsorted replays to session %s from %s", req.Session, r.RemoteAddr)
+	moved, err := ReassignFunc(req.Clips, req.From, req.To, req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(moved) == 0 {
+		http.Error(w, "No matching unsorted replays", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"moved": moved})
+}
+
+// statusHistoryHandler returns the recent status messages so a reloaded dashboard can show the timeline
+func statusHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, GetStatusHistory())
+}
+
+// logsHandler returns the most recent log lines for display in the operator UI
+func logsHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, logging.GetRecentLines())
+}
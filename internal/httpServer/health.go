@@ -0,0 +1,88 @@
+package httpServer
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck is the last result of a check reported by another part of the application
+type HealthCheck struct {
+	OK      bool      `json:"ok"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// Health is the response of GET /api/health
+type Health struct {
+	Status string                 `json:"status"` // "ok" or "degraded"
+	Checks map[string]HealthCheck `json:"checks"`
+	OBS    *OBSStatus             `json:"obs,omitempty"`
+}
+
+// OBSStatus describes the connection to the OBS WebSocket
+type OBSStatus struct {
+	Connected  bool   `json:"connected"`
+	LastError  string `json:"lastError,omitempty"`
+	Reconnects int    `json:"reconnects"` // connections restored since startup
+	InFlight   int    `json:"inFlight"`   // requests sent or waiting to be sent
+}
+
+var (
+	healthMu     sync.Mutex
+	healthChecks = make(map[string]HealthCheck)
+
+	// SelfTestFunc is registered by the application to run the ffmpeg self-test on demand
+	SelfTestFunc func() error
+	// OBSStatusFunc is registered by the application to describe the connection to OBS
+	OBSStatusFunc func() OBSStatus
+)
+
+// ReportHealth records the result of a check, err is nil when it passed
+func ReportHealth(name string, err error) {
+	check := HealthCheck{OK: err == nil, Checked: time.Now()}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	healthMu.Lock()
+	healthChecks[name] = check
+	healthMu.Unlock()
+}
+
+// currentHealth returns the checks reported so far
+func currentHealth() Health {
+	healthMu.Lock()
+	defer healthMu.Unlock()
+	health := Health{Status: "ok", Checks: make(map[string]HealthCheck, len(healthChecks))}
+	for name, check := range healthChecks {
+		health.Checks[name] = check
+		if !check.OK {
+			health.Status = "degraded"
+		}
+	}
+	return health
+}
+
+// healthHandler reports the checks, with 503 when one of them failed
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	health := currentHealth()
+	if OBSStatusFunc != nil {
+		status := OBSStatusFunc()
+		health.OBS = &status
+	}
+	httpStatus := http.StatusOK
+	if health.Status != "ok" {
+		httpStatus = http.StatusServiceUnavailable
+	}
+	writeJSON(w, httpStatus, health)
+}
+
+// selfTestHandler runs the ffmpeg self-test again, for instance after the configuration was fixed
+func selfTestHandler(w http.ResponseWriter, r *http.Request) {
+	if SelfTestFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	SelfTestFunc()
+	healthHandler(w, r)
+}
@@ -0,0 +1,227 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// PipelineStage is a step in producing the replays of an attempt
+type PipelineStage string
+
+const (
+	StageScanning PipelineStage = "scanning" // waiting for the camera files
+	StageTrimming PipelineStage = "trimming"
+	StageCopying  PipelineStage = "copying"  // to the session directory on another volume
+	StageEncoding PipelineStage = "encoding" // output profiles and vertical crops
+	StageDone     PipelineStage = "done"
+	StageFailed   PipelineStage = "failed"
+)
+
+// CameraProgress is where the replay of one camera is, Percent is the progress of its stage
+type CameraProgress struct {
+	Camera  string        `json:"camera"`
+	Stage   PipelineStage `json:"stage"`
+	Percent int           `json:"percent"`
+}
+
+// PipelineJob is an attempt being turned into replays
+type PipelineJob struct {
+	ID      int              `json:"id"`
+	Attempt string           `json:"attempt"`
+	Stage   PipelineStage    `json:"stage"`
+	Cameras []CameraProgress `json:"cameras"`
+	Error   string           `json:"error,omitempty"`
+	Started time.Time        `json:"started"`
+	Updated time.Time        `json:"updated"`
+}
+
+// PipelineState is the response of GET /api/pipeline and the data of its events: the attempts
+// being processed, oldest first, and those finished since the last one started
+type PipelineState struct {
+	Jobs []PipelineJob `json:"jobs"`
+}
+
+var (
+	pipelineMu          sync.Mutex
+	pipelineJobs        []*PipelineJob
+	pipelineLastID      int
+	pipelineSubscribers = map[chan PipelineState]bool{}
+)
+
+// pipelineKeepAlive keeps proxies from closing an event stream without updates
+const pipelineKeepAlive = 15 * time.Second
+
+// BeginPipeline starts following an attempt, scanning for its camera files, and returns the id
+// used to report its progress
+func BeginPipeline(attempt string) int {
+	pipelineMu.Lock()
+	defer pipelineMu.Unlock()
+
+	// Finished attempts were already seen by the clients following them
+	jobs := pipelineJobs[:0]
+	for _, job := range pipelineJobs {
+		if job.Stage != StageDone && job.Stage != StageFailed {
+			jobs = append(jobs, job)
+		}
+	}
+	pipelineJobs = jobs
+
+	pipelineLastID++
+	now := time.Now()
+	pipelineJobs = append(pipelineJobs, &PipelineJob{
+		ID:      pipelineLastID,
+		Attempt: attempt,
+		Stage:   StageScanning,
+		Cameras: []CameraProgress{},
+		Started: now,
+		Updated: now,
+	})
+	publishPipeline()
+	return pipelineLastID
+}
+
+// SetPipelineStage reports the stage of a whole attempt
+func SetPipelineStage(id int, stage PipelineStage) {
+	updatePipeline(id, func(job *PipelineJob) bool {
+		if job.Stage == stage {
+			return false
+		}
+		job.Stage = stage
+		return true
+	})
+}
+
+// SetCameraProgress reports the stage of one camera of an attempt and its progress in percent
+func SetCameraProgress(id int, camera string, stage PipelineStage, percent int) {
+	updatePipeline(id, func(job *PipelineJob) bool {
+		for i := range job.Cameras {
+			if job.Cameras[i].Camera != camera {
+				continue
+			}
+			if job.Cameras[i].Stage == stage && job.Cameras[i].Percent == percent {
+				return false
+			}
+			job.Cameras[i].Stage = stage
+			job.Cameras[i].Percent = percent
+			return true
+		}
+		job.Cameras = append(job.Cameras, CameraProgress{Camera: camera, Stage: stage, Percent: percent})
+		return true
+	})
+}
+
+// EndPipeline reports an attempt done, or failed with err
+func EndPipeline(id int, err error) {
+	updatePipeline(id, func(job *PipelineJob) bool {
+		job.Stage = StageDone
+		if err != nil {
+			job.Stage = StageFailed
+			job.Error = err.Error()
+		}
+		return true
+	})
+}
+
+// updatePipeline applies change to a job and publishes the state when it changed. An id of 0, for
+// an attempt that is not followed, is ignored.
+func updatePipeline(id int, change func(job *PipelineJob) bool) {
+	if id == 0 {
+		return
+	}
+	pipelineMu.Lock()
+	defer pipelineMu.Unlock()
+	for _, job := range pipelineJobs {
+		if job.ID != id {
+			continue
+		}
+		if job.Stage == StageDone || job.Stage == StageFailed {
+			return
+		}
+		if change(job) {
+			job.Updated = time.Now()
+			publishPipeline()
+		}
+		return
+	}
+}
+
+// snapshotPipeline copies the state, called with pipelineMu held
+func snapshotPipeline() PipelineState {
+	state := PipelineState{Jobs: make([]PipelineJob, 0, len(pipelineJobs))}
+	for _, job := range pipelineJobs {
+		copied := *job
+		copied.Cameras = append([]CameraProgress{}, job.Cameras...)
+		state.Jobs = append(state.Jobs, copied)
+	}
+	return state
+}
+
+// publishPipeline sends the state to the event streams, called with pipelineMu held. A client
+// that has not read the previous state only gets the latest.
+func publishPipeline() {
+	state := snapshotPipeline()
+	for updates := range pipelineSubscribers {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- state
+	}
+}
+
+// pipelineHandler returns the processing state of the recent attempts
+func pipelineHandler(w http.ResponseWriter, r *http.Request) {
+	pipelineMu.Lock()
+	state := snapshotPipeline()
+	pipelineMu.Unlock()
+	writeJSON(w, http.StatusOK, state)
+}
+
+// pipelineEventsHandler streams the processing state as server-sent "pipeline" events, starting
+// with the current one
+func pipelineEventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	updates := make(chan PipelineState, 1)
+	pipelineMu.Lock()
+	updates <- snapshotPipeline()
+	pipelineSubscribers[updates] = true
+	pipelineMu.Unlock()
+	defer func() {
+		pipelineMu.Lock()
+		delete(pipelineSubscribers, updates)
+		pipelineMu.Unlock()
+	}()
+
+	keepAlive := time.NewTicker(pipelineKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case state := <-updates:
+			data, err := json.Marshal(state)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: pipeline\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
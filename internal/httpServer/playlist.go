@@ -0,0 +1,192 @@
+package httpServer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// PlaylistEntry is an attempt of a session with the videos of all its cameras
+type PlaylistEntry struct {
+	Athlete  string       `json:"athlete"`
+	LiftType string       `json:"liftType"`
+	Attempt  int          `json:"attempt"`
+	Created  time.Time    `json:"created"`
+	Files    []ReplayFile `json:"files"`
+}
+
+// Playlist is the response of GET /api/replays/playlist, attempts in the order they were recorded
+type Playlist struct {
+	Session string          `json:"session"`
+	Entries []PlaylistEntry `json:"entries"`
+}
+
+// sessionPlaylist reads the replay manifests of a session directory, relative to the videos
+// directory, and of its lift type folders, and orders them by creation time
+func sessionPlaylist(session string) (Playlist, error) {
+	playlist := Playlist{Session: session, Entries: []PlaylistEntry{}}
+	replays, err := config.SessionReplays(session)
+	if err != nil {
+		return playlist, err
+	}
+	for _, replay := range replays {
+		playlist.Entries = append(playlist.Entries, PlaylistEntry{
+			Athlete:  replay.Manifest.Athlete,
+			LiftType: replay.Manifest.LiftType,
+			Attempt:  replay.Manifest.Attempt,
+			Created:  replay.Manifest.Created,
+			Files:    replayFiles(replay.Dir, replay.Manifest.Files),
+		})
+	}
+	return playlist, nil
+}
+
+// activeSessionDir returns the directory of the session owlcms is running, empty if none
+func activeSessionDir() string {
+	if state.CurrentSession == "" {
+		return ""
+	}
+	return path.Join(config.DateDir(time.Now()), config.SessionDirName(state.CurrentSession))
+}
+
+// playlistHandler returns the replays of a session in order, as JSON or as an M3U playlist with
+// format=m3u. The session is a directory as listed on the home page, the active one by default.
+func playlistHandler(w http.ResponseWriter, r *http.Request) {
+	session := r.URL.Query().Get("session")
+	if session == "" {
+		session = activeSessionDir()
+	}
+	if session == "" {
+		http.Error(w, "No session given and no active session", http.StatusBadRequest)
+		return
+	}
+	if !validSessionDir(session) {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	playlist, err := sessionPlaylist(session)
+	if err != nil {
+		http.Error(w, "Failed to read session directory", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "m3u" {
+		writeJSON(w, http.StatusOK, playlist)
+		return
+	}
+
+	// Media players need absolute URLs
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	var m3u strings.Builder
+	m3u.WriteString("#EXTM3U\n")
+	for _, entry := range playlist.Entries {
+		for _, file := range entry.Files {
+			fmt.Fprintf(&m3u, "#EXTINF:-1,%s - %s attempt %d - %s\n",
+				strings.ReplaceAll(entry.Athlete, "_", " "), entry.LiftType, entry.Attempt, file.Name)
+			fmt.Fprintf(&m3u, "%s://%s%s\n", scheme, r.Host, file.URL)
+		}
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl")
+	w.Write([]byte(m3u.String()))
+}
+
+// highlightsRequest selects the session and camera of a highlight reel
+type highlightsRequest struct {
+	Session string `json:"session"`
+	Camera  string `json:"camera"`
+}
+
+// highlightsHandler starts stitching the replays of a session into a single video. The session
+// defaults to the active one and the camera to 1; progress is reported as statuses.
+func highlightsHandler(w http.ResponseWriter, r *http.Request) {
+	if HighlightsFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	var req highlightsRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Session == "" {
+		req.Session = activeSessionDir()
+	}
+	if req.Session == "" {
+		http.Error(w, "No session given and no active session", http.StatusBadRequest)
+		return
+	}
+	if !validSessionDir(req.Session) {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+	if req.Camera == "" {
+		req.Camera = "1"
+	}
+	if _, err := strconv.Atoi(req.Camera); err != nil {
+		http.Error(w, "camera must be a camera number", http.StatusBadRequest)
+		return
+	}
+
+	logging.InfoLogger.Printf("Exporting highlights of session %s, Camera %s, from %s", req.Session, req.Camera, r.RemoteAddr)
+	name, err := HighlightsFunc(req.Session, req.Camera)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"file": name})
+}
+
+// deriveHandler makes the output profiles and vertical crops missing from the replays of a
+// session, after they were configured during the meet. The session defaults to the active one.
+func deriveHandler(w http.ResponseWriter, r *http.Request) {
+	if DeriveFunc == nil {
+		http.Error(w, "Recorder not initialized", http.StatusServiceUnavailable)
+		return
+	}
+	var req struct {
+		Session string `json:"session"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Session == "" {
+		req.Session = activeSessionDir()
+	}
+	if req.Session == "" {
+		http.Error(w, "No session given and no active session", http.StatusBadRequest)
+		return
+	}
+	if !validSessionDir(req.Session) {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
+	}
+
+	logging.InfoLogger.Printf("Making derived videos for session %s from %s", req.Session, r.RemoteAddr)
+	count, err := DeriveFunc(req.Session)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	status := http.StatusAccepted
+	if count == 0 {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, map[string]int{"replays": count})
+}
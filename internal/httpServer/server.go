@@ -6,6 +6,7 @@ import (
 	"html/template"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -61,6 +62,18 @@ func init() {
 	}
 }
 
+// mutating refuses a request that records or changes files when the server is read-only
+func mutating(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg := config.GetCurrentConfig(); cfg != nil && cfg.ReadOnly {
+			logging.InfoLogger.Printf("Refused %s %s from %s: read-only", r.Method, r.URL.Path, r.RemoteAddr)
+			http.Error(w, "Read-only viewer", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
 // StartServer starts the HTTP server on the specified port
 func StartServer(port int, _ bool) {
 	router := mux.NewRouter()
@@ -76,6 +89,22 @@ func StartServer(port int, _ bool) {
 
 	router.HandleFunc("/", listFilesHandler)
 	router.HandleFunc("/ws", handleWebSocket)
+	router.HandleFunc("/api/recording/force-stop", mutating(forceStopHandler)).Methods("POST")
+	router.HandleFunc("/api/reset", mutating(resetHandler)).Methods("POST")
+	router.HandleFunc("/api/recording/bookmark", mutating(bookmarkHandler)).Methods("POST")
+	router.HandleFunc("/api/recording/current", currentRecordingHandler).Methods("GET")
+	router.HandleFunc("/api/status/history", statusHistoryHandler).Methods("GET")
+	router.HandleFunc("/api/preview/{camera}", previewHandler).Methods("GET")
+	router.HandleFunc("/api/replays/latest", latestReplayHandler).Methods("GET")
+	router.HandleFunc("/api/replays/playlist", playlistHandler).Methods("GET")
+	router.HandleFunc("/api/replays/highlights", mutating(highlightsHandler)).Methods("POST")
+	router.HandleFunc("/api/derive", mutating(deriveHandler)).Methods("POST")
+	router.HandleFunc("/api/reassign", mutating(reassignHandler)).Methods("POST")
+	router.HandleFunc("/api/health", healthHandler).Methods("GET")
+	router.HandleFunc("/api/pipeline", pipelineHandler).Methods("GET")
+	router.HandleFunc("/api/pipeline/events", pipelineEventsHandler).Methods("GET")
+	router.HandleFunc("/api/selftest", mutating(selfTestHandler)).Methods("POST")
+	router.HandleFunc("/api/logs", logsHandler).Methods("GET")
 
 	addr := fmt.Sprintf(":%d", port)
 	Server = &http.Server{
@@ -94,23 +123,31 @@ func StartServer(port int, _ bool) {
 
 // listFilesHandler lists all files in the videos directory as clickable hyperlinks
 func listFilesHandler(w http.ResponseWriter, r *http.Request) {
-	files, err := os.ReadDir(config.GetVideoDir())
+	dirs, err := config.SessionDirs()
 	if err != nil {
 		http.Error(w, "Failed to read videos directory", http.StatusInternalServerError)
 		return
 	}
 
-	// Get selected session from query parameter or active session
+	// Get selected session from query parameter or active session, in today's folder with datePrefix
 	selectedSession := r.URL.Query().Get("session")
-	if selectedSession == "" {
-		selectedSession = strings.ReplaceAll(state.CurrentSession, " ", "_")
+	if selectedSession == "" && state.CurrentSession != "" {
+		selectedSession = path.Join(config.DateDir(time.Now()), config.SessionDirName(state.CurrentSession))
+	}
+	if !validSessionDir(selectedSession) {
+		http.Error(w, "Invalid session", http.StatusBadRequest)
+		return
 	}
 
-	// Get list of sessions (subdirectories)
+	// Get list of sessions (subdirectories), the warm-up recordings are not a session
+	warmupDir := ""
+	if cfg := config.GetCurrentConfig(); cfg != nil {
+		warmupDir = cfg.Warmup.Dir
+	}
 	var sessions []string
-	for _, f := range files {
-		if f.IsDir() && f.Name() != "unsorted" {
-			sessions = append(sessions, f.Name())
+	for _, dir := range dirs {
+		if path.Base(dir) != "unsorted" && dir != warmupDir {
+			sessions = append(sessions, dir)
 		}
 	}
 
@@ -125,63 +162,74 @@ func listFilesHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Create directory if it doesn't exist yet
 	sessionDir := filepath.Join(config.GetVideoDir(), selectedSession)
-	if selectedSession != "" && selectedSession != "unsorted" {
+	if selectedSession != "" && path.Base(selectedSession) != "unsorted" && !config.GetCurrentConfig().ReadOnly {
 		if err := os.MkdirAll(sessionDir, os.ModePerm); err != nil {
 			logging.ErrorLogger.Printf("Failed to create session directory: %v", err)
 		}
 	}
 
-	// Read files from the session directory
-	sessionDir = filepath.Join(config.GetVideoDir(), selectedSession)
-	files, err = os.ReadDir(sessionDir)
-	if err != nil && !os.IsNotExist(err) {
-		http.Error(w, "Failed to read session directory", http.StatusInternalServerError)
-		return
+	// Read files from the session directory and its lift type folders
+	type sessionFile struct {
+		dir  string
+		name string
+	}
+	var files []sessionFile
+	for _, dir := range config.ReplayDirs(selectedSession) {
+		entries, err := os.ReadDir(filepath.Join(config.GetVideoDir(), filepath.FromSlash(dir)))
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(w, "Failed to read session directory", http.StatusInternalServerError)
+			return
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, sessionFile{dir: dir, name: entry.Name()})
+			}
+		}
 	}
 
 	// Sort files in reverse order (most recent first)
 	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() > files[j].Name()
+		return files[i].name > files[j].name
 	})
 
-	// Count only valid video files (those starting with a date)
-	datePattern := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
-	validFiles := make([]os.DirEntry, 0)
-	for _, file := range files {
-		if !file.IsDir() && datePattern.MatchString(file.Name()) {
-			validFiles = append(validFiles, file)
-		}
-	}
-
-	// Regex to extract date, hour, name, lift type, attempt, and camera
+	// Regex to extract the timestamp and name, lift type, attempt, camera and variant (vertical, profile name)
+	re := regexp.MustCompile(`^(.+)_(CLEANJERK|SNATCH)_attempt(\d+)_Camera([^_]+?)(?:_(.+))?\.mp4$`)
 
-	// Regex to extract date, hour, name, lift type, attempt, and camera
-	re := regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})_(\d{2}h\d{2}m\d{2}s)_(.+)_(CLEANJERK|SNATCH)_attempt(\d+)_Camera(\d+)\.mp4$`)
+	// The timestamp layout is configurable and may itself contain underscores
+	timestampName := config.TimestampNameRegexp()
 
 	videos := make([]VideoInfo, 0)
-	for _, file := range validFiles {
-		if !file.IsDir() {
-			fileName := file.Name()
-			// Replace Clean_and_Jerk with CJ
-			fileName2 := strings.ReplaceAll(fileName, "Clean_and_Jerk", "CJ")
-			matches := re.FindStringSubmatch(fileName2)
-			if len(matches) == 7 {
-				date := matches[1]
-				hourMinuteSeconds := strings.NewReplacer("h", ":", "m", ":", "s", "").Replace(matches[2])
-				name := strings.ReplaceAll(matches[3], "_", " ")
-				lift := matches[4]
-				attempt := matches[5]
-				camera := matches[6]
-				displayName := fmt.Sprintf("%s %s - %s - %s - attempt %s - Camera %s",
-					date, hourMinuteSeconds, name, lift, attempt, camera)
-				// Use forward slashes for URL path
-				urlPath := strings.Join([]string{selectedSession, fileName}, "/")
-				videos = append(videos, VideoInfo{
-					Filename:    urlPath,
-					DisplayName: displayName,
-				})
-			}
+	for _, file := range files {
+		fileName := file.name
+		// Replace Clean_and_Jerk with CJ
+		fileName2 := strings.ReplaceAll(fileName, "Clean_and_Jerk", "CJ")
+		matches := re.FindStringSubmatch(fileName2)
+		if len(matches) != 6 {
+			continue
+		}
+		parts := timestampName.FindStringSubmatch(matches[1])
+		if parts == nil {
+			continue
 		}
+		timestamp := parts[1]
+		if t, err := config.ParseTimestamp(timestamp); err == nil {
+			timestamp = t.Format("2006-01-02 15:04:05")
+		}
+		name := strings.ReplaceAll(parts[2], "_", " ")
+		lift := matches[2]
+		attempt := matches[3]
+		camera := matches[4]
+		if variant := matches[5]; variant != "" {
+			camera = fmt.Sprintf("%s (%s)", camera, variant)
+		}
+		displayName := fmt.Sprintf("%s - %s - %s - attempt %s - Camera %s",
+			timestamp, name, lift, attempt, camera)
+		// Use forward slashes for URL path
+		urlPath := strings.Join([]string{file.dir, fileName}, "/")
+		videos = append(videos, VideoInfo{
+			Filename:    urlPath,
+			DisplayName: displayName,
+		})
 	}
 
 	data := TemplateData{
@@ -214,26 +262,16 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	mu.Lock()
 	clients[conn] = true
-	// Send current status immediately after connection
+	// Send current status immediately after connection, never asking a page that just reloaded
+	// to reload again
 	if statusMsg != "" {
-		// prevent infinite loop if we are reloading after saving videos
-		if VideoReadyReloading {
-			statusMsg = "Videos ready"
-			statusCode = Ready
-			if err := conn.WriteJSON(StatusMessage{Code: statusCode, Text: statusMsg}); err != nil {
-				logging.ErrorLogger.Printf("Failed to send initial status: %v", err)
-			}
-			VideoReadyReloading = false
-		} else {
-			if strings.Contains(statusMsg, "Recording") {
-				statusCode = Recording
-			}
-			if err := conn.WriteJSON(StatusMessage{Code: statusCode, Text: statusMsg}); err != nil {
-				logging.ErrorLogger.Printf("Failed to send initial status: %v", err)
-			}
+		if strings.Contains(statusMsg, "Recording") {
+			statusCode = Recording
+		}
+		if err := conn.WriteJSON(StatusMessage{Code: statusCode, Text: statusMsg, Time: statusTime}); err != nil {
+			logging.ErrorLogger.Printf("Failed to send initial status: %v", err)
 		}
 	}
-	VideoReadyReloading = false
 	mu.Unlock()
 
 	// Keep the connection alive until it closes
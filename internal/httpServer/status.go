@@ -2,7 +2,10 @@ package httpServer
 
 import (
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/owlcms/obsreplays/internal/config"
 	"github.com/owlcms/obsreplays/internal/logging"
 	"github.com/owlcms/obsreplays/internal/state"
 )
@@ -14,37 +17,72 @@ const (
 	Recording
 	Trimming
 	Error
+	Idle // sent idleAfterSeconds after Ready when nothing happened meanwhile
 )
 
 type StatusMessage struct {
 	Code    StatusCode `json:"code"`
 	Text    string     `json:"text"`
 	Session string     `json:"session"` // Add session field
+	Time    time.Time  `json:"time"`
+	Reload  bool       `json:"reload,omitempty"` // new videos are ready, the page reloads its list
+}
+
+// StatusHistoryEntry is a status message with the time it was sent
+type StatusHistoryEntry struct {
+	Time    time.Time  `json:"time"`
+	Code    StatusCode `json:"code"`
+	Text    string     `json:"text"`
+	Session string     `json:"session"`
 }
 
 var (
-	StatusChan          = make(chan StatusMessage, 10)
-	statusMsg           string
-	statusCode          StatusCode
-	VideoReadyReloading bool
+	statusHistory   []StatusHistoryEntry
+	statusHistoryMu sync.Mutex
+)
+
+var (
+	StatusChan = make(chan StatusMessage, 10)
+	statusMsg  string
+	statusCode StatusCode
+	statusTime time.Time
+)
+
+// statusSeq counts the status messages, the Idle status is only sent if none came after Ready
+var (
+	statusSeq int
+	idleTimer *time.Timer
 )
 
 // SendStatus sends a status update to all clients through the broadcast channel
 // and updates the Fyne UI through StatusChan
 func SendStatus(code StatusCode, text string) {
-	// Simplify the "Videos ready" message for web display
-	VideoReadyReloading = false
-	if code == Ready && strings.Contains(text, "Videos ready") {
-		text = "Reloading..."
-		VideoReadyReloading = true
+	sendStatus(code, text, -1)
+}
+
+// sendStatus sends the status, when seq is not negative only if no other status was sent since
+// statusSeq was seq. The check and the sends are made under mu, so a status sent meanwhile is never
+// overwritten by a stale one.
+func sendStatus(code StatusCode, text string, seq int) {
+	mu.Lock()
+	defer mu.Unlock()
+	if seq >= 0 && statusSeq != seq {
+		return
 	}
+	recordStatus(code, text)
+
+	// Web pages reload their list of videos, still showing the clip length and lead-in
 	msg := StatusMessage{
 		Code:    code,
 		Text:    text,
 		Session: state.CurrentSession, // Include current session in message
+		Time:    time.Now(),
+		Reload:  code == Ready && strings.Contains(text, "Videos ready"),
 	}
-	mu.Lock()
+	scheduleIdle(code)
 	statusMsg = text
+	statusCode = code
+	statusTime = msg.Time
 	for client := range clients {
 		logging.InfoLogger.Printf("Sending status update: %s", text)
 		if err := client.WriteJSON(msg); err != nil {
@@ -54,8 +92,55 @@ func SendStatus(code StatusCode, text string) {
 			continue
 		}
 	}
-	mu.Unlock()
 
-	// Also send to Fyne UI
+	// Also send to Fyne UI, in the same order as the web clients
 	StatusChan <- msg
 }
+
+// scheduleIdle sends the Idle status idleAfterSeconds after a Ready status, unless another status
+// is sent first. Called with mu held.
+func scheduleIdle(code StatusCode) {
+	statusSeq++
+	if idleTimer != nil {
+		idleTimer.Stop()
+		idleTimer = nil
+	}
+	cfg := config.GetCurrentConfig()
+	if code != Ready || cfg == nil || cfg.IdleAfterSeconds <= 0 {
+		return
+	}
+	seq := statusSeq
+	idleTimer = time.AfterFunc(time.Duration(cfg.IdleAfterSeconds)*time.Second, func() {
+		sendStatus(Idle, "Idle: ready for the next lift", seq)
+	})
+}
+
+// recordStatus adds a status message to the bounded history
+func recordStatus(code StatusCode, text string) {
+	size := 0
+	if cfg := config.GetCurrentConfig(); cfg != nil {
+		size = cfg.StatusHistorySize
+	}
+	if size <= 0 {
+		return
+	}
+
+	statusHistoryMu.Lock()
+	defer statusHistoryMu.Unlock()
+	statusHistory = append(statusHistory, StatusHistoryEntry{
+		Time:    time.Now(),
+		Code:    code,
+		Text:    text,
+		Session: state.CurrentSession,
+	})
+	if len(statusHistory) > size {
+		statusHistory = append([]StatusHistoryEntry(nil), statusHistory[len(statusHistory)-size:]...)
+	}
+}
+
+// GetStatusHistory returns the recent status messages, oldest first
+func GetStatusHistory() []StatusHistoryEntry {
+	statusHistoryMu.Lock()
+	defer statusHistoryMu.Unlock()
+	return append([]StatusHistoryEntry{}, statusHistory...)
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+)
+
+// liftAbbreviations shortens the owlcms lift types in log prefixes
+var liftAbbreviations = map[string]string{
+	"SNATCH":    "SN",
+	"CLEANJERK": "CJ",
+}
+
+// AttemptLogger prefixes log lines with the attempt they belong to, e.g. [Smith CJ #2],
+// so that the lines of a failed replay can be found in a busy log
+type AttemptLogger struct {
+	prefix string
+}
+
+// ForAttempt returns a logger for the lines concerning one attempt
+func ForAttempt(athlete, liftType string, attempt int, session string) *AttemptLogger {
+	lift := liftType
+	if short, ok := liftAbbreviations[liftType]; ok {
+		lift = short
+	}
+	prefix := fmt.Sprintf("[%s %s #%d", strings.ReplaceAll(athlete, "_", " "), lift, attempt)
+	if session != "" {
+		prefix += " " + session
+	}
+	return &AttemptLogger{prefix: prefix + "] "}
+}
+
+// Info logs an informational message for the attempt
+func (l *AttemptLogger) Info(format string, v ...interface{}) {
+	InfoLogger.Printf(l.prefix+format, v...)
+}
+
+// Warning logs a warning for the attempt
+func (l *AttemptLogger) Warning(format string, v ...interface{}) {
+	WarningLogger.Printf(l.prefix+format, v...)
+}
+
+// Error logs an error for the attempt
+func (l *AttemptLogger) Error(format string, v ...interface{}) {
+	ErrorLogger.Printf(l.prefix+format, v...)
+}
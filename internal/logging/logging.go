@@ -7,17 +7,61 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 )
 
+// recentLinesSize is the number of log lines kept in memory for the operator UI
+const recentLinesSize = 500
+
 var (
 	InfoLogger    *log.Logger
 	WarningLogger *log.Logger
 	ErrorLogger   *log.Logger
 	logFile       *os.File
+	errorLogFile  *os.File
 	logDir        string
 	Verbose       bool // Move Verbose flag here from config package
+	warnWriter    io.Writer
+	errorWriter   io.Writer
+	recentLines   = &lineBuffer{size: recentLinesSize}
 )
 
+// lineBuffer keeps the most recent log lines in memory
+type lineBuffer struct {
+	mu    sync.Mutex
+	lines []string
+	size  int
+}
+
+// Write stores each line written by a logger
+func (b *lineBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines = append(b.lines, strings.Split(strings.TrimRight(string(p), "\n"), "\n")...)
+	// Trim only once the buffer has doubled to avoid copying on every line
+	if len(b.lines) > 2*b.size {
+		b.lines = append([]string(nil), b.lines[len(b.lines)-b.size:]...)
+	}
+	return len(p), nil
+}
+
+// recent returns a copy of the most recent lines, oldest first
+func (b *lineBuffer) recent() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start := 0
+	if len(b.lines) > b.size {
+		start = len(b.lines) - b.size
+	}
+	return append([]string{}, b.lines[start:]...)
+}
+
+// GetRecentLines returns the most recent log lines, oldest first
+func GetRecentLines() []string {
+	return recentLines.recent()
+}
+
 // Trace logs a debug message that only appears when verbose logging is enabled
 func Trace(format string, v ...interface{}) {
 	if Verbose {
@@ -52,18 +96,18 @@ func Init(logDirectory string) error {
 	}
 	fmt.Printf("Log file created successfully: %s\n", logFile.Name())
 
-	// Initialize writers based on platform
-	var infoWriter, warnWriter, errorWriter io.Writer
+	// Initialize writers based on platform, all lines are also kept in memory for the UI
+	var infoWriter io.Writer
 	if runtime.GOOS == "windows" {
 		// Windows: write to file only because of console behavior
-		infoWriter = io.MultiWriter(logFile)
-		warnWriter = io.MultiWriter(logFile)
-		errorWriter = io.MultiWriter(logFile)
+		infoWriter = io.MultiWriter(logFile, recentLines)
+		warnWriter = io.MultiWriter(logFile, recentLines)
+		errorWriter = io.MultiWriter(logFile, recentLines)
 	} else {
 		// Linux/WSL: write to both console and file
-		infoWriter = io.MultiWriter(os.Stdout, logFile)
-		warnWriter = io.MultiWriter(os.Stdout, logFile)
-		errorWriter = io.MultiWriter(os.Stderr, logFile)
+		infoWriter = io.MultiWriter(os.Stdout, logFile, recentLines)
+		warnWriter = io.MultiWriter(os.Stdout, logFile, recentLines)
+		errorWriter = io.MultiWriter(os.Stderr, logFile, recentLines)
 	}
 
 	// Initialize loggers with timestamps and source file info
@@ -78,9 +122,36 @@ func Init(logDirectory string) error {
 	return nil
 }
 
+// EnableErrorLog additionally writes warnings and errors to errors.log for quick scanning
+func EnableErrorLog() error {
+	if errorLogFile != nil {
+		return nil
+	}
+	var err error
+	errorLogFile, err = os.OpenFile(filepath.Join(logDir, "errors.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_SYNC, 0666)
+	if err != nil {
+		return err
+	}
+	WarningLogger.SetOutput(io.MultiWriter(warnWriter, errorLogFile))
+	ErrorLogger.SetOutput(io.MultiWriter(errorWriter, errorLogFile))
+	InfoLogger.Printf("Warnings and errors are also logged to %s", errorLogFile.Name())
+	return nil
+}
+
+// GetLogFilePath returns the path of the current log file, or an empty string before Init
+func GetLogFilePath() string {
+	if logFile == nil {
+		return ""
+	}
+	return logFile.Name()
+}
+
 // Close closes the log file
 func Close() {
 	if logFile != nil {
 		logFile.Close()
 	}
+	if errorLogFile != nil {
+		errorLogFile.Close()
+	}
 }
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+const (
+	// clockSamples requests are made to owlcms, the one with the shortest round trip is used
+	clockSamples = 3
+	clockTimeout = 5 * time.Second
+)
+
+// checkClockOffset compares the clock of this computer to the clock of the owlcms web server and
+// warns when they differ by more than clockOffsetWarningMs. owlcms sends its time in the Date
+// header, to the second, so the offset is only known to about half a second.
+func checkClockOffset(cfg *config.Config) {
+	if cfg.ClockOffsetWarningMs == 0 {
+		return
+	}
+	url := config.OwlcmsWebURL(cfg)
+	if url == "" {
+		return
+	}
+	offset, err := measureClockOffset(url)
+	if err != nil {
+		logging.WarningLogger.Printf("Could not compare the clock with owlcms at %s: %v", url, err)
+		return
+	}
+	logging.InfoLogger.Printf("Clock offset with owlcms: %+.1fs (positive when owlcms is ahead)", offset.Seconds())
+
+	if offset < 0 {
+		offset = -offset
+	}
+	if offset <= time.Duration(cfg.ClockOffsetWarningMs)*time.Millisecond {
+		httpServer.ReportHealth("clockOffset", nil)
+		return
+	}
+	err = fmt.Errorf("the clock of this computer differs from owlcms by %.1fs", offset.Seconds())
+	logging.WarningLogger.Printf("%v, set both computers to the same time server", err)
+	httpServer.ReportHealth("clockOffset", err)
+	httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Warning: %v", err))
+}
+
+// measureClockOffset returns how far the owlcms clock is ahead of the local clock
+func measureClockOffset(url string) (time.Duration, error) {
+	client := &http.Client{Timeout: clockTimeout}
+	var best, bestRoundTrip time.Duration
+	found := false
+	for i := 0; i < clockSamples; i++ {
+		sent := time.Now()
+		resp, err := client.Head(url)
+		if err != nil {
+			return 0, err
+		}
+		received := time.Now()
+		resp.Body.Close()
+		serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+		if err != nil {
+			return 0, fmt.Errorf("no Date header in the response: %w", err)
+		}
+
+		// The Date header is truncated to the second, on average half a second behind
+		roundTrip := received.Sub(sent)
+		offset := serverTime.Add(500 * time.Millisecond).Sub(sent.Add(roundTrip / 2))
+		if !found || roundTrip < bestRoundTrip {
+			best, bestRoundTrip, found = offset, roundTrip, true
+		}
+	}
+	return best, nil
+}
@@ -34,7 +34,7 @@ func DiscoverBroker() (string, error) {
 
 	// Scan addresses in subnet
 	for i := 1; i < 255; i++ {
-		target := fmt.Sprintf("%s.%d:1883", subnet, i)
+		target := net.JoinHostPort(fmt.Sprintf("%s.%d", subnet, i), config.DefaultMQTTPort)
 		logging.InfoLogger.Printf("Scanning %s", target)
 		if IsPortOpen(target) {
 			return target, nil
@@ -83,7 +83,12 @@ func IsPortOpen(address string) bool {
 
 func UpdateOwlcmsAddress(cfg *config.Config, configFile string) (string, error) {
 	broker := cfg.OwlCMS
-	owlcmsAddress := fmt.Sprintf("%s:1883", broker)
+	if cfg.MQTTBroker != "" {
+		// Events come from a separately configured broker, there is nothing to discover
+		logging.InfoLogger.Printf("Using MQTT broker %s", cfg.MQTTBroker)
+		return broker, nil
+	}
+	owlcmsAddress := config.BrokerAddress(broker)
 	if cfg.OwlCMS != "" && IsPortOpen(owlcmsAddress) {
 		logging.InfoLogger.Printf("OwlCMS broker is reachable at %s\n", owlcmsAddress)
 	} else {
@@ -95,8 +100,8 @@ func UpdateOwlcmsAddress(cfg *config.Config, configFile string) (string, error)
 			return broker, err
 		}
 		logging.InfoLogger.Printf("Broker found: %s\n", broker)
-		// remove the port number
-		broker = strings.Split(broker, ":")[0]
+		// remove the port number if it is the default one
+		broker = config.NormalizeOwlcmsAddress(broker)
 		cfg.OwlCMS = broker
 		if err := config.UpdateConfigFile(configFile, broker); err != nil {
 			fmt.Printf("Error updating config file: %v\n", err)
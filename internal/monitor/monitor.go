@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -24,19 +25,60 @@ type ConfigMessage struct {
 
 var (
 	mqttClient mqtt.Client
+	// topicPrefix is the first part of the owlcms topics, "owlcms" unless the broker is shared
+	topicPrefix = "owlcms"
+	// topics subscribed so far, subscribed again after a reconnection
+	subscribedTopics []string
+	subscribedMu     sync.Mutex
 	// Channel to notify when platform list is updated
 	PlatformListChan = make(chan []string, 1)
 	// Add new function to show platform dialog
 	ShowPlatformDialogFunc func()
+	// otherGroup is set while the attempt on the platform belongs to a group that is not recorded
+	otherGroup bool
+	// currentBreak is the owlcms break in progress, empty outside breaks, and when it started
+	currentBreak      string
+	currentBreakStart time.Time
 )
 
+// maxBreakDuration is how long a break lasts at most, in case its end was not received
+const maxBreakDuration = 30 * time.Minute
+
 // Monitor listens to the owlcms broker for specific messages
 func Monitor(cfg *config.Config) {
-	// First establish MQTT connection
-	mqttAddress := fmt.Sprintf("tcp://%s:1883", cfg.OwlCMS)
+	// First establish MQTT connection, to the owlcms broker unless another one is configured
+	mqttAddress := fmt.Sprintf("tcp://%s", config.BrokerAddress(cfg.OwlCMS))
+	if cfg.MQTTBroker != "" {
+		mqttAddress = cfg.MQTTBroker
+	}
+	if cfg.MQTTTopicPrefix != "" {
+		topicPrefix = strings.TrimSuffix(cfg.MQTTTopicPrefix, "/")
+	}
 	opts := mqtt.NewClientOptions().AddBroker(mqttAddress)
 	opts.SetClientID("obsreplays-monitor")
 	opts.SetDefaultPublishHandler(messageHandler())
+	if cfg.MQTTUsername != "" {
+		opts.SetUsername(cfg.MQTTUsername)
+		opts.SetPassword(cfg.MQTTPassword)
+	}
+
+	// Reconnect with increasing delays and restore the subscriptions
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(30 * time.Second)
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		logging.WarningLogger.Printf("Lost connection to MQTT broker %s: %v", mqttAddress, err)
+	})
+	opts.SetReconnectingHandler(func(client mqtt.Client, opts *mqtt.ClientOptions) {
+		logging.InfoLogger.Printf("Reconnecting to MQTT broker %s", mqttAddress)
+	})
+	subscribedMu.Lock()
+	subscribedTopics = nil
+	subscribedMu.Unlock()
+	opts.SetOnConnectHandler(func(client mqtt.Client) {
+		resubscribe(client)
+		// A venue computer may have been off the network, and its clock adrift, since the last check
+		go checkClockOffset(config.GetCurrentConfig())
+	})
 
 	mqttClient = mqtt.NewClient(opts)
 	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
@@ -58,10 +100,9 @@ func Monitor(cfg *config.Config) {
 	}
 
 	// First subscribe to config topic
-	configTopic := "owlcms/fop/config"
-	logging.InfoLogger.Printf("Subscribing to topic %s", configTopic)
-	if token := mqttClient.Subscribe(configTopic, 0, nil); token.Wait() && token.Error() != nil {
-		logging.ErrorLogger.Printf("Failed to subscribe to topic %s: %v", configTopic, token.Error())
+	configTopic := topicName("fop/config")
+	if err := subscribe(configTopic); err != nil {
+		logging.ErrorLogger.Printf("Failed to subscribe to topic %s: %v", configTopic, err)
 		mqttClient.Disconnect(250)
 		return
 	}
@@ -92,24 +133,61 @@ func Monitor(cfg *config.Config) {
 		return
 	}
 
+	// Load the OBS scene collection and profile for this platform
+	if err := recording.ApplyPlatformSettings(cfg.Platform); err != nil {
+		logging.ErrorLogger.Printf("Failed to apply OBS settings for platform %s: %v", cfg.Platform, err)
+		httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+	}
+
 	// Subscribe to platform-specific topics
 	platformTopics := []string{
-		"owlcms/fop/start",
-		"owlcms/fop/stop",
-		"owlcms/fop/refereesDecision",
+		"fop/start",
+		"fop/stop",
+		"fop/refereesDecision",
+		"fop/break",
 	}
 
 	for _, topic := range platformTopics {
-		fullTopic := topic + "/" + cfg.Platform
-		logging.InfoLogger.Printf("Subscribing to topic %s", fullTopic)
-		if token := mqttClient.Subscribe(fullTopic, 0, nil); token.Wait() && token.Error() != nil {
-			logging.ErrorLogger.Printf("Failed to subscribe to topic %s: %v", fullTopic, token.Error())
+		fullTopic := topicName(topic) + "/" + cfg.Platform
+		if err := subscribe(fullTopic); err != nil {
+			logging.ErrorLogger.Printf("Failed to subscribe to topic %s: %v", fullTopic, err)
 		}
 	}
 
 	logging.InfoLogger.Printf("MQTT monitoring started on %s", mqttAddress)
 }
 
+// topicName returns the full name of an owlcms topic
+func topicName(topic string) string {
+	return topicPrefix + "/" + topic
+}
+
+// subscribe subscribes to a topic and remembers it for reconnections
+func subscribe(topic string) error {
+	logging.InfoLogger.Printf("Subscribing to topic %s", topic)
+	if token := mqttClient.Subscribe(topic, 0, nil); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	subscribedMu.Lock()
+	subscribedTopics = append(subscribedTopics, topic)
+	subscribedMu.Unlock()
+	return nil
+}
+
+// resubscribe restores the subscriptions after the client reconnects to the broker
+func resubscribe(client mqtt.Client) {
+	subscribedMu.Lock()
+	topics := append([]string(nil), subscribedTopics...)
+	subscribedMu.Unlock()
+
+	for _, topic := range topics {
+		logging.InfoLogger.Printf("Subscribing again to topic %s", topic)
+		if token := client.Subscribe(topic, 0, nil); token.Wait() && token.Error() != nil {
+			logging.ErrorLogger.Printf("Failed to subscribe to topic %s: %v", topic, token.Error())
+		}
+	}
+}
+
 func validatePlatform(cfg *config.Config, platforms []string) bool {
 	if cfg.Platform == "" {
 		return false
@@ -138,7 +216,7 @@ func GetValidatedPlatforms(cfg *config.Config) ([]string, bool) {
 	}
 
 	// Request fresh platform list using existing MQTT client
-	topic := "owlcms/config"
+	topic := topicName("config")
 	token := mqttClient.Publish(topic, 0, false, "requesting configuration")
 	if token.Wait() && token.Error() != nil {
 		logging.ErrorLogger.Printf("Failed to publish config request: %v", token.Error())
@@ -159,7 +237,7 @@ func GetValidatedPlatforms(cfg *config.Config) ([]string, bool) {
 
 // PublishConfig simplified as it's now only used with the existing connection
 func PublishConfig(platform string) {
-	topic := "owlcms/config"
+	topic := topicName("config")
 	token := mqttClient.Publish(topic, 0, false, "requesting configuration")
 	if token.Wait() && token.Error() != nil {
 		logging.ErrorLogger.Printf("Failed to publish config request: %v", token.Error())
@@ -170,35 +248,95 @@ func messageHandler() mqtt.MessageHandler {
 	return func(client mqtt.Client, msg mqtt.Message) {
 		topic := msg.Topic()
 		payload := string(msg.Payload())
+		logging.Trace("MQTT message on %s: %s", topic, payload)
 
-		// Split topic for message handling
+		// Split topic for message handling, without the prefix and the platform
+		if !strings.HasPrefix(topic, topicPrefix+"/") {
+			return
+		}
+		topic = strings.TrimPrefix(topic, topicPrefix+"/")
 		topicParts := strings.Split(topic, "/")
-		if len(topicParts) < 3 {
+		if len(topicParts) < 2 {
 			return
 		}
-		topic = strings.Join(topicParts[:3], "/")
+		topic = strings.Join(topicParts[:2], "/")
+
+		// Only the events of this instance's platform drive the recording; topics of a previously
+		// selected platform may still be subscribed
+		if topic != "fop/config" {
+			platform := ""
+			if len(topicParts) > 2 {
+				platform = strings.Join(topicParts[2:], "/")
+			}
+			if cfg := config.GetCurrentConfig(); platform != cfg.Platform {
+				logging.Trace("Ignoring %s for platform %q, recording platform %q", topic, platform, cfg.Platform)
+				return
+			}
+		}
 
 		switch topic {
-		case "owlcms/fop/start":
+		case "fop/start":
 			handleStart(payload)
-		case "owlcms/fop/stop":
+		case "fop/stop":
 			handleStop(payload)
-		case "owlcms/fop/break":
+		case "fop/break":
 			handleBreak(payload)
-		case "owlcms/fop/refereesDecision":
-			handleRefereesDecision()
-		case "owlcms/fop/config":
+		case "fop/refereesDecision":
+			handleRefereesDecision(payload)
+		case "fop/config":
 			handleConfig(payload)
 		}
 	}
 }
 
+// breakEndPayloads end a break, in upper case
+var breakEndPayloads = map[string]bool{"": true, "NONE": true, "END": true, "DONE": true, "BREAK_DONE": true}
+
 func handleBreak(payload string) {
-	if payload == "GROUP_DONE" {
+	breakType := strings.TrimSpace(payload)
+	if breakEndPayloads[strings.ToUpper(breakType)] {
+		if currentBreak != "" {
+			logging.InfoLogger.Printf("Break %s ended, recording clock starts again", currentBreak)
+			currentBreak = ""
+		}
+		return
+	}
+
+	if breakType == "GROUP_DONE" {
 		logging.InfoLogger.Println("Session ended")
 		state.CurrentSession = ""                                    // Clear current session
 		httpServer.SendStatus(httpServer.Ready, "No active session") // Update web UI with session state
+		currentBreak = ""                                            // The next session starts without a break
+		return
+	}
+	if !config.GetCurrentConfig().IgnoreStartsInBreak {
+		return
+	}
+	if currentBreak == "" {
+		logging.InfoLogger.Printf("Break %s started, ignoring clock starts until it ends", breakType)
+		currentBreakStart = time.Now()
+	}
+	currentBreak = breakType
+}
+
+// breakOver tells why the break in progress is over although its end was not received, from a
+// clock start for another session, athlete or attempt than before the break, or from its length.
+// It returns an empty string while the break goes on.
+func breakOver(payload string) string {
+	if time.Since(currentBreakStart) > maxBreakDuration {
+		return fmt.Sprintf("no end received after %v", maxBreakDuration)
 	}
+	startMsg, err := state.ParseStartMessage(payload)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case startMsg.Session != state.CurrentSession:
+		return fmt.Sprintf("clock started for session %s", startMsg.Session)
+	case startMsg.AthleteName != state.CurrentAthlete || startMsg.AttemptNumber != state.CurrentAttempt:
+		return fmt.Sprintf("clock started for %s attempt %d", startMsg.AthleteName, startMsg.AttemptNumber)
+	}
+	return ""
 }
 
 func handleConfig(payload string) {
@@ -225,7 +363,24 @@ func handleConfig(payload string) {
 func handleStart(payload string) {
 	// Handle start message
 	logging.InfoLogger.Printf("Handling start message: %s", payload)
+	if currentBreak != "" {
+		reason := breakOver(payload)
+		if reason == "" {
+			logging.WarningLogger.Printf("Ignoring clock start during break %s", currentBreak)
+			return
+		}
+		logging.WarningLogger.Printf("Break %s taken as ended, %s", currentBreak, reason)
+		currentBreak = ""
+	}
 	state.UpdateStateFromStartMessage(payload)
+
+	// During combined sessions only the configured group is recorded
+	if group := config.GetCurrentConfig().Group; group != "" && !strings.EqualFold(state.CurrentSession, group) {
+		logging.InfoLogger.Printf("Not recording %s: group %q is not %q", state.CurrentAthlete, state.CurrentSession, group)
+		otherGroup = true
+		return
+	}
+	otherGroup = false
 	if err := recording.StartRecording(state.CurrentAthlete, state.CurrentLiftType, state.CurrentAttempt); err != nil {
 		logging.ErrorLogger.Printf("Failed to start recording: %v", err)
 		return
@@ -236,12 +391,20 @@ func handleStop(payload string) {
 	// Handle stop message
 	logging.InfoLogger.Printf("Handling stop message: %s", payload)
 	state.UpdateStateFromStopMessage(payload)
+	if !otherGroup && currentBreak == "" {
+		recording.ClockStopped()
+	}
 }
 
-func handleRefereesDecision() {
+func handleRefereesDecision(payload string) {
 	// Handle refereesDecision message
 	logging.InfoLogger.Printf("Handling refereesDecision message")
+	if otherGroup {
+		logging.InfoLogger.Println("Ignoring decision for an attempt of another group")
+		return
+	}
 	state.LastDecisionTime = time.Now().UnixNano() / int64(time.Millisecond)
+	state.UpdateStateFromDecisionMessage(payload)
 	logging.InfoLogger.Println("Trimming video")
 	go func() {
 		defer func() {
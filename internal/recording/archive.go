@@ -0,0 +1,65 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// archiveRetryDelays are the waits before copying a replay to the archive again, a NAS can be
+// unreachable for a while during a meet
+var archiveRetryDelays = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// archiveReplay copies the files of a replay to the archive directory in the background, keeping
+// their location relative to the videos directory. Failures are retried and never affect the replay.
+func archiveReplay(log *logging.AttemptLogger, files []string) {
+	archiveDir := config.GetCurrentConfig().ArchiveDir
+	if archiveDir == "" {
+		return
+	}
+	go func() {
+		pending := files
+		for attempt := 0; ; attempt++ {
+			pending = copyToArchive(log, archiveDir, pending)
+			if len(pending) == 0 {
+				log.Info("Archived %d file(s) to %s", len(files), archiveDir)
+				return
+			}
+			if attempt == len(archiveRetryDelays) {
+				log.Error("Giving up archiving %d file(s) to %s", len(pending), archiveDir)
+				return
+			}
+			log.Warning("Archiving %d file(s) failed, retrying in %v", len(pending), archiveRetryDelays[attempt])
+			time.Sleep(archiveRetryDelays[attempt])
+		}
+	}()
+}
+
+// copyToArchive copies files to the archive and returns those that could not be copied
+func copyToArchive(log *logging.AttemptLogger, archiveDir string, files []string) []string {
+	var failed []string
+	for _, file := range files {
+		if err := copyFileToArchive(archiveDir, file); err != nil {
+			log.Warning("Failed to archive %s: %v", file, err)
+			failed = append(failed, file)
+		}
+	}
+	return failed
+}
+
+// copyFileToArchive copies a file of the videos directory to the same place under the archive
+func copyFileToArchive(archiveDir, file string) error {
+	relative, err := filepath.Rel(config.GetVideoDir(), file)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(archiveDir, relative)
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return copyVerified(file, target)
+}
@@ -0,0 +1,69 @@
+package recording
+
+import (
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// activeRecording is the attempt being recorded, between the start and the stop of its recording
+type activeRecording struct {
+	athlete  string
+	liftType string
+	attempt  int
+	session  string
+}
+
+var (
+	currentMu sync.Mutex
+	current   *activeRecording
+)
+
+// setCurrentRecording remembers the attempt whose recording just started
+func setCurrentRecording() {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = &activeRecording{
+		athlete:  state.CurrentAthlete,
+		liftType: state.CurrentLiftType,
+		attempt:  state.CurrentAttempt,
+		session:  state.CurrentSession,
+	}
+}
+
+// clearCurrentRecording forgets the attempt once its recording is stopped
+func clearCurrentRecording() {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = nil
+}
+
+// CurrentRecording describes the recording in progress for dashboards. The elapsed time is counted
+// from the start of the attempt's clock.
+func CurrentRecording() httpServer.CurrentRecording {
+	currentMu.Lock()
+	active := current
+	currentMu.Unlock()
+	if active == nil {
+		return httpServer.CurrentRecording{}
+	}
+
+	recording := httpServer.CurrentRecording{
+		Recording: true,
+		Athlete:   active.athlete,
+		LiftType:  active.liftType,
+		Attempt:   active.attempt,
+		Session:   active.session,
+	}
+	if start := state.LastStartTime; start != 0 {
+		started := time.Unix(0, start*int64(time.Millisecond))
+		recording.Started = &started
+		recording.ElapsedSeconds = time.Since(started).Seconds()
+	}
+	pauseMu.Lock()
+	recording.Paused = pausedAt != 0
+	pauseMu.Unlock()
+	return recording
+}
@@ -0,0 +1,105 @@
+package recording
+
+import (
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// During jury deliberations owlcms can send bursts of clock and decision events. Within the quiet
+// period after a start, further starts and stops are ignored so that no fragment is recorded.
+// A stop followed closely by a start, such as when an attempt is changed, continues the same
+// recording when a coalesce window is configured.
+
+var (
+	debounceMu sync.Mutex
+	// lastStart is when the last accepted recording started
+	lastStart time.Time
+	// pendingStop is closed by a start that continues the recording being stopped
+	pendingStop chan struct{}
+)
+
+// quietPeriod returns the configured quiet period, 0 when disabled
+func quietPeriod() time.Duration {
+	return time.Duration(config.GetCurrentConfig().QuietPeriodMs) * time.Millisecond
+}
+
+// acceptStart reports whether a start request should be acted upon, and remembers accepted starts
+func acceptStart(log *logging.AttemptLogger) bool {
+	debounceMu.Lock()
+	defer debounceMu.Unlock()
+	if quiet := quietPeriod(); quiet > 0 && !lastStart.IsZero() {
+		if elapsed := time.Since(lastStart); elapsed < quiet {
+			log.Info("Ignoring start %d ms after the previous one (quiet period %d ms)", elapsed.Milliseconds(), quiet.Milliseconds())
+			return false
+		}
+	}
+	lastStart = time.Now()
+	return true
+}
+
+// waitForContinuation holds a stop for the coalesce window and reports whether a start arrived meanwhile
+func waitForContinuation() bool {
+	window := time.Duration(config.GetCurrentConfig().CoalesceWindowMs) * time.Millisecond
+	if window <= 0 {
+		return false
+	}
+	cancel := make(chan struct{})
+	debounceMu.Lock()
+	pendingStop = cancel
+	debounceMu.Unlock()
+
+	select {
+	case <-cancel:
+		return true
+	case <-time.After(window):
+	}
+
+	debounceMu.Lock()
+	defer debounceMu.Unlock()
+	if pendingStop != cancel {
+		// A start got in just as the window closed
+		return true
+	}
+	pendingStop = nil
+	return false
+}
+
+// continueRecording cancels a stop held by waitForContinuation and reports whether there was one
+func continueRecording() bool {
+	debounceMu.Lock()
+	defer debounceMu.Unlock()
+	if pendingStop == nil {
+		return false
+	}
+	close(pendingStop)
+	pendingStop = nil
+	return true
+}
+
+// resetDebounce forgets the last start and drops a stop held for the coalesce window
+func resetDebounce() {
+	debounceMu.Lock()
+	defer debounceMu.Unlock()
+	lastStart = time.Time{}
+	if pendingStop != nil {
+		close(pendingStop)
+		pendingStop = nil
+	}
+}
+
+// acceptStop reports whether a stop request should be acted upon
+func acceptStop() bool {
+	debounceMu.Lock()
+	defer debounceMu.Unlock()
+	if quiet := quietPeriod(); quiet > 0 && !lastStart.IsZero() {
+		if elapsed := time.Since(lastStart); elapsed < quiet {
+			logging.InfoLogger.Printf("Ignoring stop %d ms after the start (quiet period %d ms)", elapsed.Milliseconds(), quiet.Milliseconds())
+			return false
+		}
+	}
+	lastStart = time.Time{}
+	return true
+}
@@ -0,0 +1,170 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+// deriveMu allows one backfill at a time, they would compete for the same files
+var (
+	deriveMu      sync.Mutex
+	deriveRunning bool
+)
+
+// cameraReplayRegexp matches the main replay of a camera, not its derivatives
+var cameraReplayRegexp = regexp.MustCompile(`_Camera([^_]+)\.mp4$`)
+
+// pendingReplay is a replay of a session missing some of the configured derivatives
+type pendingReplay struct {
+	manifestFile string
+	manifest     types.ReplayManifest
+	outputs      map[string][]derivative // by camera replay file
+}
+
+// DeriveSession makes the output profiles and vertical crops now configured for the replays of
+// a session that do not have them yet, from their trimmed replays. session is a directory
+// relative to the videos directory. It returns how many replays will be updated; the work is done
+// in the background, one file per processing slot, and reported as statuses.
+func DeriveSession(session string) (int, error) {
+	cfg := config.GetCurrentConfig()
+	var pending []pendingReplay
+	for _, dir := range config.ReplayDirs(session) {
+		dir = filepath.Join(config.GetVideoDir(), filepath.FromSlash(dir))
+		replays, err := missingDerivatives(cfg, dir)
+		if err != nil {
+			return 0, err
+		}
+		pending = append(pending, replays...)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	deriveMu.Lock()
+	if deriveRunning {
+		deriveMu.Unlock()
+		return 0, fmt.Errorf("derived videos are already being made")
+	}
+	deriveRunning = true
+	deriveMu.Unlock()
+
+	beginWork()
+	go func() {
+		defer func() {
+			deriveMu.Lock()
+			deriveRunning = false
+			deriveMu.Unlock()
+		}()
+		failed := 0
+		for i, replay := range pending {
+			httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Making derived videos: replay %d of %d", i+1, len(pending)))
+			if err := replay.derive(); err != nil {
+				failed++
+				httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+			}
+		}
+		updateSessionIndex(filepath.Join(config.GetVideoDir(), filepath.FromSlash(session)))
+		if failed > 0 {
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Derived videos made for %d of %d replays of %s",
+				len(pending)-failed, len(pending), session))
+			endWork("", "")
+			return
+		}
+		endWork("derived videos of "+session+" made",
+			fmt.Sprintf("Derived videos ready for %d replays of %s", len(pending), session))
+	}()
+	return len(pending), nil
+}
+
+// missingDerivatives lists the replays of a directory, from their manifests, with the derivatives
+// whose files do not exist
+func missingDerivatives(cfg *config.Config, dir string) ([]pendingReplay, error) {
+	manifestFiles, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var pending []pendingReplay
+	for _, manifestFile := range manifestFiles {
+		data, err := os.ReadFile(manifestFile)
+		if err != nil {
+			return nil, err
+		}
+		var manifest types.ReplayManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			logging.WarningLogger.Printf("Skipping invalid replay manifest %s: %v", manifestFile, err)
+			continue
+		}
+
+		replay := pendingReplay{manifestFile: manifestFile, manifest: manifest, outputs: map[string][]derivative{}}
+		base := strings.TrimSuffix(filepath.Base(manifestFile), ".json")
+		for _, name := range manifest.Files {
+			matches := cameraReplayRegexp.FindStringSubmatch(name)
+			if matches == nil || name != fmt.Sprintf("%s_Camera%s.mp4", base, matches[1]) {
+				continue
+			}
+			source := filepath.Join(dir, name)
+			for _, output := range derivatives(cfg, source, dir, base, matches[1]) {
+				if _, err := os.Stat(output.file); err == nil {
+					continue
+				}
+				replay.outputs[source] = append(replay.outputs[source], output)
+			}
+		}
+		if len(replay.outputs) > 0 {
+			pending = append(pending, replay)
+		}
+	}
+	return pending, nil
+}
+
+// derive makes the missing derivatives of a replay and adds them to its manifest
+func (replay pendingReplay) derive() error {
+	manifest := replay.manifest
+	log := logging.ForAttempt(manifest.Athlete, manifest.LiftType, manifest.Attempt, manifest.Session)
+	var made []string
+	var failure error
+	for source, outputs := range replay.outputs {
+		if _, err := os.Stat(source); err != nil {
+			log.Warning("Replay %s is missing, no derived videos made from it", source)
+			continue
+		}
+		for _, output := range outputs {
+			// One file at a time in a processing slot, live attempts are queued with it
+			release := takeSlot(func(running int) { log.Info("Derived videos queued, %d job(s) running", running) })
+			cmd := createFfmpegCmd(output.args)
+			log.Info("Executing %s command for %s: %s", output.name, filepath.Base(source), cmd.String())
+			err := cmd.Run()
+			release()
+			if err != nil {
+				os.Remove(output.file)
+				failure = fmt.Errorf("failed to %s from %s: %w", output.action, filepath.Base(source), err)
+				log.Error("%v", failure)
+				continue
+			}
+			made = append(made, output.file)
+		}
+	}
+	if len(made) == 0 {
+		return failure
+	}
+
+	for _, file := range made {
+		manifest.Files = append(manifest.Files, filepath.Base(file))
+	}
+	if err := writeManifest(replay.manifestFile, manifest); err != nil {
+		log.Warning("Failed to update manifest %s: %v", replay.manifestFile, err)
+	}
+	log.Info("Made %d derived video(s)", len(made))
+	archiveReplay(log, append(made, replay.manifestFile))
+	return failure
+}
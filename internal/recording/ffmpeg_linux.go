@@ -4,17 +4,12 @@ import (
 	"os/exec"
 	"syscall"
 
-	"github.com/owlcms/obsreplays/internal/config"
 	"github.com/owlcms/obsreplays/internal/logging"
 )
 
 // createFfmpegCmd creates an exec.Cmd for ffmpeg
 func createFfmpegCmd(args []string) *exec.Cmd {
-	cameras := config.GetCameraConfigs()
-	path := "ffmpeg"
-	if len(cameras) > 0 {
-		path = cameras[0].FfmpegPath
-	}
+	path := FfmpegPath
 
 	// If no path configured, try to find ffmpeg in PATH
 	if path == "" {
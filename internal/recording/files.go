@@ -0,0 +1,198 @@
+package recording
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// copyBufferSize is the buffer used for copies, larger than the io.Copy default to suit multi-minute
+// clips on network shares and USB drives
+const copyBufferSize = 1 << 20
+
+// copyProgressInterval is how often the progress of a copy is reported
+const copyProgressInterval = time.Second
+
+// stableSizeInterval and stableSizeTimeout control how a file is watched until it stops growing
+const (
+	stableSizeInterval = 200 * time.Millisecond
+	stableSizeTimeout  = 5 * time.Second
+)
+
+// waitForStableSize waits until a file is not empty and its size stays the same between two checks,
+// so that it is not read while the writer is still flushing it
+func waitForStableSize(path string) error {
+	deadline := time.Now().Add(stableSizeTimeout)
+	previous := int64(-1)
+	for {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", path, err)
+		}
+		if info.Size() > 0 && info.Size() == previous {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			if info.Size() == 0 {
+				return fmt.Errorf("%s is still empty after %v", path, stableSizeTimeout)
+			}
+			return fmt.Errorf("%s still growing after %v", path, stableSizeTimeout)
+		}
+		previous = info.Size()
+		time.Sleep(stableSizeInterval)
+	}
+}
+
+// copyVerified copies src to dst and checks that the destination matches the source, starting
+// over after a delay that doubles each time if the copy was interrupted or corrupted, as happens
+// with network shares
+func copyVerified(src, dst string) error {
+	return copyVerifiedWithProgress(src, dst, nil)
+}
+
+// copyVerifiedWithProgress is copyVerified calling progress with the bytes copied so far and the
+// size of the file every copyProgressInterval, progress may be nil
+func copyVerifiedWithProgress(src, dst string, progress func(copied, total int64)) error {
+	cfg := config.GetCurrentConfig()
+	attempts, delay := cfg.CopyAttempts, time.Duration(cfg.CopyRetryDelayMs)*time.Millisecond
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = copyAndVerify(src, dst, progress); err == nil {
+			return nil
+		}
+		if isPermanentCopyError(err) {
+			logging.ErrorLogger.Printf("Copy to %s failed, not retrying: %v", dst, err)
+			break
+		}
+		logging.WarningLogger.Printf("Copy attempt %d of %d to %s failed: %v", attempt, attempts, dst, err)
+		if attempt < attempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	// Do not leave a partial file that looks like a finished replay
+	os.Remove(dst)
+	return err
+}
+
+// moveFile moves src to dst, creating the destination directory. Across volumes, where a rename
+// is not possible, the file is copied and verified before the source is removed.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	if err := copyVerified(src, dst); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// isPermanentCopyError reports whether trying the copy again cannot help
+func isPermanentCopyError(err error) bool {
+	return errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrNotExist)
+}
+
+// copyAndVerify performs a single copy, flushes it to disk and compares sizes and SHA-256 checksums
+func copyAndVerify(src, dst string, progress func(copied, total int64)) error {
+	sourceFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer sourceFile.Close()
+
+	sourceInfo, err := sourceFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	destFile, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+
+	sourceHash := sha256.New()
+	writer := &progressWriter{w: destFile, total: sourceInfo.Size(), progress: progress, last: time.Now()}
+	copied, err := io.CopyBuffer(writer, io.TeeReader(sourceFile, sourceHash), make([]byte, copyBufferSize))
+	if err != nil {
+		destFile.Close()
+		return fmt.Errorf("failed to copy: %w", err)
+	}
+	if copied != sourceInfo.Size() {
+		destFile.Close()
+		return fmt.Errorf("short copy: %d of %d bytes", copied, sourceInfo.Size())
+	}
+	// Make sure the replay survives a power loss once it is reported as ready
+	if err := destFile.Sync(); err != nil {
+		destFile.Close()
+		return fmt.Errorf("failed to flush destination file: %w", err)
+	}
+	if err := destFile.Close(); err != nil {
+		return fmt.Errorf("failed to close destination file: %w", err)
+	}
+
+	destInfo, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("failed to stat destination file: %w", err)
+	}
+	if sourceInfo.Size() != destInfo.Size() {
+		return fmt.Errorf("size mismatch: source %d bytes, destination %d bytes", sourceInfo.Size(), destInfo.Size())
+	}
+
+	destHash, err := hashFile(dst)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sourceHash.Sum(nil), destHash) {
+		return fmt.Errorf("checksum mismatch between %s and %s", src, dst)
+	}
+
+	logging.Trace("Verified %s (sha256 %s)", dst, hex.EncodeToString(destHash))
+	return nil
+}
+
+// progressWriter counts the bytes written and reports them every copyProgressInterval
+type progressWriter struct {
+	w        io.Writer
+	copied   int64
+	total    int64
+	progress func(copied, total int64)
+	last     time.Time
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.copied += int64(n)
+	if pw.progress != nil && time.Since(pw.last) >= copyProgressInterval {
+		pw.progress(pw.copied, pw.total)
+		pw.last = time.Now()
+	}
+	return n, err
+}
+
+// hashFile returns the SHA-256 checksum of a file
+func hashFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s for verification: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("failed to read %s for verification: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
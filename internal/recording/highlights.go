@@ -0,0 +1,193 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// highlightsMu prevents two exports from writing the same reel
+var (
+	highlightsMu      sync.Mutex
+	highlightsRunning = map[string]bool{}
+)
+
+// highlightClip is a replay of the reel with its video size
+type highlightClip struct {
+	file          string
+	width, height int
+	duration      float64
+}
+
+// ExportHighlights starts stitching the replays of one camera of a session, in the order they
+// were recorded, into <session>_Camera<camera>_highlights.mp4 in the session directory. The export
+// takes a processing slot, so it waits for the attempts being trimmed. session is a directory
+// relative to the videos directory. Progress and completion are reported as statuses; the
+// returned name is the file being written.
+func ExportHighlights(session, camera string) (string, error) {
+	sessionDir := filepath.Join(config.GetVideoDir(), filepath.FromSlash(session))
+	clips, err := highlightClips(session, camera)
+	if err != nil {
+		return "", err
+	}
+	if len(clips) == 0 {
+		return "", fmt.Errorf("no replays of Camera %s in session %s", camera, session)
+	}
+	outputFile := filepath.Join(sessionDir, fmt.Sprintf("%s_Camera%s_highlights.mp4", filepath.Base(sessionDir), camera))
+
+	highlightsMu.Lock()
+	if highlightsRunning[outputFile] {
+		highlightsMu.Unlock()
+		return "", fmt.Errorf("highlights of Camera %s of session %s are already being exported", camera, session)
+	}
+	highlightsRunning[outputFile] = true
+	highlightsMu.Unlock()
+
+	name := filepath.Base(outputFile)
+	beginWork()
+	go func() {
+		defer func() {
+			highlightsMu.Lock()
+			delete(highlightsRunning, outputFile)
+			highlightsMu.Unlock()
+		}()
+		release := takeSlot(func(running int) {
+			logging.InfoLogger.Printf("Highlights export %s queued, %d job(s) running", name, running)
+		})
+		defer release()
+		if err := writeHighlights(clips, outputFile); err != nil {
+			logging.ErrorLogger.Printf("Failed to export highlights of session %s: %v", session, err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Highlights export failed: %v", err))
+			endWork("", "")
+			return
+		}
+		logging.InfoLogger.Printf("Exported %d replays of Camera %s to %s", len(clips), camera, outputFile)
+		endWork("highlights "+name+" exported", fmt.Sprintf("Highlights ready: %s", name))
+	}()
+	return filepath.Base(outputFile), nil
+}
+
+// highlightClips lists the replays of a camera in a session directory and its lift type folders,
+// oldest first, from the replay manifests
+func highlightClips(session, camera string) ([]highlightClip, error) {
+	replays, err := config.SessionReplays(session)
+	if err != nil {
+		return nil, err
+	}
+
+	suffix := fmt.Sprintf("_Camera%s.mp4", camera)
+	var clips []highlightClip
+	for _, replay := range replays {
+		dir := filepath.Join(config.GetVideoDir(), filepath.FromSlash(replay.Dir))
+		for _, name := range replay.Manifest.Files {
+			if !strings.HasSuffix(name, suffix) {
+				continue
+			}
+			clip := highlightClip{file: filepath.Join(dir, name)}
+			if clip.width, clip.height, err = probeSize(clip.file); err != nil {
+				logging.WarningLogger.Printf("Leaving %s out of the highlights: %v", name, err)
+				continue
+			}
+			if clip.duration, err = probeDuration(clip.file); err != nil {
+				logging.WarningLogger.Printf("Leaving %s out of the highlights: %v", name, err)
+				continue
+			}
+			clips = append(clips, clip)
+		}
+	}
+	return clips, nil
+}
+
+// probeSize returns the width and height of the video stream of a file
+func probeSize(fileName string) (int, int, error) {
+	cmd := createFfprobeCmd([]string{
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=width,height",
+		"-of", "csv=p=0",
+		fileName,
+	})
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	width, height, found := strings.Cut(strings.TrimSpace(string(output)), ",")
+	if !found {
+		return 0, 0, fmt.Errorf("no video stream")
+	}
+	w, err := strconv.Atoi(width)
+	if err != nil {
+		return 0, 0, err
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(height))
+	if err != nil {
+		return 0, 0, err
+	}
+	return w, h, nil
+}
+
+// highlightArgs returns the ffmpeg arguments concatenating the clips listed in listFile. Clips
+// of the same size are copied; otherwise all are scaled and padded to the size of the largest.
+func highlightArgs(clips []highlightClip, listFile, outputFile string) []string {
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", listFile}
+
+	width, height := clips[0].width, clips[0].height
+	sameSize := true
+	for _, clip := range clips[1:] {
+		if clip.width != clips[0].width || clip.height != clips[0].height {
+			sameSize = false
+		}
+		if clip.width*clip.height > width*height {
+			width, height = clip.width, clip.height
+		}
+	}
+	if sameSize {
+		args = append(args, "-c", "copy")
+	} else {
+		args = append(args,
+			"-vf", fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease,pad=%d:%d:(ow-iw)/2:(oh-ih)/2,setsar=1",
+				width, height, width, height),
+			"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p",
+			"-c:a", "aac")
+	}
+	return withProgress(append(args, "-movflags", "+faststart", outputFile))
+}
+
+// writeHighlights runs ffmpeg on the clips and reports its progress
+func writeHighlights(clips []highlightClip, outputFile string) error {
+	listFile := outputFile + ".txt"
+	var list strings.Builder
+	var total float64
+	for _, clip := range clips {
+		// The concat demuxer quotes file names with single quotes
+		fmt.Fprintf(&list, "file '%s'\n", strings.ReplaceAll(filepath.ToSlash(clip.file), "'", `'\''`))
+		total += clip.duration
+	}
+	if err := os.WriteFile(listFile, []byte(list.String()), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+
+	args := highlightArgs(clips, listFile, outputFile)
+	logging.InfoLogger.Printf("Exporting highlights: ffmpeg %s", strings.Join(args, " "))
+	cmd := createFfmpegCmd(args)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	name := filepath.Base(outputFile)
+	if err := runWithProgress(cmd, total, func(percent int) {
+		httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Exporting highlights %s: %d%%", name, percent))
+	}); err != nil {
+		os.Remove(outputFile)
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return fmt.Errorf("ffmpeg: %v: %s", err, strings.TrimSpace(lines[len(lines)-1]))
+	}
+	return nil
+}
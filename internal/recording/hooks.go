@@ -0,0 +1,113 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// Values of {status} in postRecordCommand
+const (
+	hookReady     = "ready"     // the replay was filed
+	hookDiscarded = "discarded" // a no lift was discarded
+	hookFailed    = "failed"    // no replay could be made
+)
+
+// attemptFields returns the owlcms fields of an attempt with its weight and result, when known,
+// as the weight and result fields
+func attemptFields(fields map[string]string, weight int, decision string) map[string]string {
+	all := make(map[string]string, len(fields)+2)
+	for name, value := range fields {
+		all[name] = value
+	}
+	if weight > 0 {
+		all["weight"] = fmt.Sprintf("%d", weight)
+	}
+	if decision != "" {
+		all["result"] = decision
+	}
+	return all
+}
+
+// postRecordHook runs postRecordCommand for an attempt, status is one of hookReady, hookDiscarded
+// or hookFailed
+func (job *recordingJob) postRecordHook(status string) {
+	fields := attemptFields(job.fields, job.weight, job.decision)
+	fields["status"] = status
+	runHook("post-record", config.GetCurrentConfig().PostRecordCommand, job.log, job.athlete, job.liftType,
+		job.attempt, job.session, fields)
+}
+
+// runHook runs an integrator command (lights, HDMI matrix...) for an attempt. The athlete, lift,
+// attempt, session and the other owlcms fields are given to the command as environment variables,
+// OBSREPLAYS_ATHLETE or OBSREPLAYS_TEAM, and {athlete} or {team} in the command are replaced by a
+// quoted reference to them, so that a value is never read as shell syntax.
+// A failing hook is logged and never prevents the recording from proceeding.
+func runHook(name, command string, log *logging.AttemptLogger, athlete, liftType string, attempt int, session string, fields map[string]string) {
+	if command == "" {
+		return
+	}
+	variables := map[string]string{
+		"athlete": strings.ReplaceAll(athlete, "_", " "),
+		"lift":    liftType,
+		"attempt": fmt.Sprintf("%d", attempt),
+		"session": session,
+	}
+	for field, value := range fields {
+		if _, ok := variables[field]; !ok {
+			variables[field] = value
+		}
+	}
+	var replacements []string
+	env := os.Environ()
+	for placeholder, value := range variables {
+		variable := hookVariable(placeholder)
+		replacements = append(replacements, "{"+placeholder+"}", shellVariable(variable))
+		env = append(env, variable+"="+value)
+	}
+	command = strings.NewReplacer(replacements...).Replace(command)
+
+	timeout := time.Duration(config.GetCurrentConfig().HookTimeoutSeconds) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := createShellCmd(ctx, command)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	log.Info("Running %s command: %s", name, command)
+	err := cmd.Run()
+	if out := strings.TrimSpace(stdout.String()); out != "" {
+		log.Info("%s command output: %s", name, out)
+	}
+	if out := strings.TrimSpace(stderr.String()); out != "" {
+		log.Warning("%s command error output: %s", name, out)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Error("%s command timed out after %v", name, timeout)
+	} else if err != nil {
+		log.Error("%s command failed: %v", name, err)
+	}
+}
+
+// hookVariable returns the environment variable giving a placeholder value to hook commands, owlcms
+// field names such as recordAttempt give OBSREPLAYS_RECORDATTEMPT
+func hookVariable(placeholder string) string {
+	return "OBSREPLAYS_" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, placeholder)
+}
@@ -0,0 +1,22 @@
+package recording
+
+import (
+	"context"
+	"os/exec"
+)
+
+// createShellCmd creates an exec.Cmd running a command line through the shell
+func createShellCmd(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// shellVariable returns the reference to an environment variable in a shell command line, quoted so
+// that its value is a single argument
+func shellVariable(name string) string {
+	return `"${` + name + `}"`
+}
+
+// createSoundCmd creates an exec.Cmd playing a sound file through PulseAudio or PipeWire
+func createSoundCmd(ctx context.Context, file string) *exec.Cmd {
+	return exec.CommandContext(ctx, "paplay", file)
+}
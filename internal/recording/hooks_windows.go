@@ -0,0 +1,39 @@
+//go:build windows && !darwin && !linux
+
+package recording
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// createShellCmd creates an exec.Cmd running a command line through cmd.exe, without a console window
+func createShellCmd(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd.exe")
+	// cmd.exe does its own parsing, pass the command line as written. Delayed expansion (/V:ON) reads
+	// variables after the command line is parsed, their values cannot add commands.
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine:       `cmd.exe /V:ON /C ` + command,
+		CreationFlags: windows.CREATE_NO_WINDOW,
+	}
+	return cmd
+}
+
+// shellVariable returns the delayed expansion of an environment variable in a cmd.exe command
+// line, quoted so that its value is a single argument
+func shellVariable(name string) string {
+	return `"!` + name + `!"`
+}
+
+// createSoundCmd creates an exec.Cmd playing a .wav file, without a console window
+func createSoundCmd(ctx context.Context, file string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "powershell.exe", "-NoProfile", "-NonInteractive", "-Command",
+		"(New-Object Media.SoundPlayer $args[0]).PlaySync()", file)
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: windows.CREATE_NO_WINDOW,
+	}
+	return cmd
+}
@@ -0,0 +1,45 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+// bookmarkChapters converts bookmarks relative to the recording start into chapters of a clip
+// from which leadIn milliseconds were trimmed, dropping marks that fall in the trimmed part
+func bookmarkChapters(bookmarks []int64, leadIn int64) []types.ReplayChapter {
+	marks := append([]int64(nil), bookmarks...)
+	sort.Slice(marks, func(i, j int) bool { return marks[i] < marks[j] })
+
+	chapters := []types.ReplayChapter{}
+	for _, mark := range marks {
+		if mark < leadIn {
+			continue
+		}
+		chapters = append(chapters, types.ReplayChapter{
+			Time:  float64(mark-leadIn) / 1000,
+			Title: fmt.Sprintf("Bookmark %d", len(chapters)+1),
+		})
+	}
+	return chapters
+}
+
+// writeManifest writes the manifest of a replay as JSON, listing the files by name. The caller's
+// list of files is left as it is.
+func writeManifest(fileName string, manifest types.ReplayManifest) error {
+	files := make([]string, len(manifest.Files))
+	for i, file := range manifest.Files {
+		files[i] = filepath.Base(file)
+	}
+	manifest.Files = files
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(fileName, data, 0644)
+}
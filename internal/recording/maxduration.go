@@ -0,0 +1,59 @@
+package recording
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+var (
+	maxDurationMu sync.Mutex
+	// maxDurationTimer stops a recording that runs longer than maxRecordingSeconds
+	maxDurationTimer *time.Timer
+)
+
+// startMaxDuration arms the safety timer for a recording that just started, in case the stop
+// or the decision from owlcms is lost
+func startMaxDuration(log *logging.AttemptLogger) {
+	seconds := config.GetCurrentConfig().MaxRecordingSeconds
+	if seconds <= 0 {
+		return
+	}
+	maxDurationMu.Lock()
+	defer maxDurationMu.Unlock()
+	if maxDurationTimer != nil {
+		maxDurationTimer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Duration(seconds)*time.Second, func() {
+		maxDurationMu.Lock()
+		current := maxDurationTimer == timer
+		maxDurationMu.Unlock()
+		if !current {
+			return
+		}
+		log.Warning("No stop received after %d seconds, stopping the recording", seconds)
+		httpServer.SendStatus(httpServer.Error,
+			fmt.Sprintf("Warning: recording stopped after the %d second limit, no stop was received from owlcms", seconds))
+		// Whatever clock stop was received, the lift may be anywhere in an over-long recording
+		if err := stopRecording(NoDecision, true); err != nil {
+			log.Error("Failed to stop recording at the time limit: %v", err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+		}
+	})
+	maxDurationTimer = timer
+}
+
+// cancelMaxDuration disarms the safety timer once the recording is stopped
+func cancelMaxDuration() {
+	maxDurationMu.Lock()
+	defer maxDurationMu.Unlock()
+	if maxDurationTimer != nil {
+		maxDurationTimer.Stop()
+		maxDurationTimer = nil
+	}
+}
@@ -0,0 +1,58 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// soundTimeout stops a ready sound that would play for too long
+const soundTimeout = 15 * time.Second
+
+// notifyReady plays the ready sound and flashes the OBS source, if configured. It returns at once
+// and failures are only logged, the replay is ready regardless.
+func notifyReady(log *logging.AttemptLogger) {
+	cfg := config.GetCurrentConfig()
+	if cfg.ReadySound != "" {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), soundTimeout)
+			defer cancel()
+			if err := createSoundCmd(ctx, cfg.ReadySound).Run(); err != nil {
+				log.Warning("Failed to play ready sound %s: %v", cfg.ReadySound, err)
+			}
+		}()
+	}
+	if cfg.ReadyFlashSource != "" {
+		go func() {
+			if err := flashSource(cfg.ReadyFlashScene, cfg.ReadyFlashSource, time.Duration(cfg.ReadyFlashMs)*time.Millisecond); err != nil {
+				log.Warning("Failed to flash OBS source %s: %v", cfg.ReadyFlashSource, err)
+			}
+		}()
+	}
+}
+
+// flashSource shows a source of an OBS scene for a while, then hides it again
+func flashSource(scene, source string, duration time.Duration) error {
+	if obsClient == nil {
+		return fmt.Errorf("not connected to OBS")
+	}
+	if scene == "" {
+		current, err := obsClient.GetCurrentProgramScene()
+		if err != nil {
+			return err
+		}
+		scene = current
+	}
+	id, err := obsClient.GetSceneItemID(scene, source)
+	if err != nil {
+		return err
+	}
+	if err := obsClient.SetSceneItemEnabled(scene, id, true); err != nil {
+		return err
+	}
+	time.Sleep(duration)
+	return obsClient.SetSceneItemEnabled(scene, id, false)
+}
@@ -0,0 +1,178 @@
+package recording
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// sourceRecordFilterKind is the OBS filter kind registered by the Source Record plugin
+const sourceRecordFilterKind = "source_record_filter"
+
+// CheckSourceRecord verifies that the Source Record plugin is installed and that at least one
+// scene or source has an enabled Source Record filter, without which no camera files are produced
+func CheckSourceRecord() error {
+	kinds, err := obsClient.GetSourceFilterKindList()
+	if err != nil {
+		// Older OBS WebSocket versions do not support listing filter kinds
+		logging.Trace("Could not list OBS filter kinds, skipping plugin check: %v", err)
+	} else {
+		installed := false
+		for _, kind := range kinds {
+			if kind == sourceRecordFilterKind {
+				installed = true
+				break
+			}
+		}
+		if !installed {
+			return fmt.Errorf("the OBS Source Record plugin is not installed, no camera files will be recorded")
+		}
+	}
+
+	sources, err := obsClient.GetSourceNames()
+	if err != nil {
+		return fmt.Errorf("failed to list OBS scenes and sources: %w", err)
+	}
+
+	found := 0
+	for _, source := range sources {
+		filters, err := obsClient.GetSourceFilterList(source)
+		if err != nil {
+			logging.Trace("Could not list filters for %s: %v", source, err)
+			continue
+		}
+		for _, filter := range filters {
+			if filter.Kind != sourceRecordFilterKind {
+				continue
+			}
+			if !filter.Enabled {
+				logging.WarningLogger.Printf("Source Record filter %q on %q is disabled", filter.Name, source)
+				continue
+			}
+			logging.InfoLogger.Printf("Source Record filter %q found on %q", filter.Name, source)
+			checkRecordingFormat(filter, source)
+			found++
+		}
+	}
+
+	if found == 0 {
+		return fmt.Errorf("no enabled Source Record filter found in OBS, no camera files will be recorded")
+	}
+	return nil
+}
+
+// checkRecordingFormat warns when a Source Record filter records files in a format that the camera
+// file pattern does not match, typically because recordingFormat is not set to that format
+func checkRecordingFormat(filter obsFilter, source string) {
+	format, _ := filter.Settings["rec_format"].(string)
+	if format == "" {
+		return
+	}
+	// Fragmented and hybrid MP4 and MOV files keep the plain extension
+	format = strings.TrimPrefix(strings.TrimPrefix(format, "fragmented_"), "hybrid_")
+	if !config.GetCurrentConfig().CameraFileRegexp().MatchString("Camera1." + format) {
+		logging.WarningLogger.Printf("Source Record filter %q on %q records %s files, which cameraFilePattern does not match; set recordingFormat = %q",
+			filter.Name, source, format, format)
+	}
+}
+
+// CheckVideoSettings verifies that OBS outputs at least minWidth x minHeight at minFps, and reports
+// the result in the health checks. It returns nil when no minimum is configured.
+func CheckVideoSettings() error {
+	cfg := config.GetCurrentConfig()
+	if cfg.MinWidth == 0 && cfg.MinHeight == 0 && cfg.MinFps == 0 {
+		return nil
+	}
+	settings, err := obsClient.GetVideoSettings()
+	if err != nil {
+		err = fmt.Errorf("failed to get the OBS video settings: %w", err)
+		httpServer.ReportHealth("obsVideoSettings", err)
+		return err
+	}
+	logging.InfoLogger.Printf("OBS video: canvas %dx%d, output %dx%d at %.4g fps",
+		settings.BaseWidth, settings.BaseHeight, settings.OutputWidth, settings.OutputHeight, settings.Fps)
+
+	var problems []string
+	if settings.OutputWidth < cfg.MinWidth || settings.OutputHeight < cfg.MinHeight {
+		problems = append(problems, fmt.Sprintf("output resolution %dx%d is below %dx%d",
+			settings.OutputWidth, settings.OutputHeight, cfg.MinWidth, cfg.MinHeight))
+	}
+	if settings.Fps < cfg.MinFps {
+		problems = append(problems, fmt.Sprintf("frame rate %.4g fps is below %g", settings.Fps, cfg.MinFps))
+	}
+	if len(problems) > 0 {
+		err = fmt.Errorf("OBS %s, check Settings > Video", strings.Join(problems, " and "))
+	}
+	httpServer.ReportHealth("obsVideoSettings", err)
+	return err
+}
+
+// ApplyPlatformSettings checks that OBS uses the scene collection and profile configured for the
+// platform, or for all platforms, and switches to them unless obsSwitchSettings is false
+func ApplyPlatformSettings(platform string) error {
+	cfg := config.GetCurrentConfig()
+	settings := cfg.OBSPlatforms[platform]
+	if settings.SceneCollection == "" {
+		settings.SceneCollection = cfg.OBSSceneCollection
+	}
+	if settings.Profile == "" {
+		settings.Profile = cfg.OBSProfile
+	}
+	if settings.SceneCollection == "" && settings.Profile == "" {
+		return nil
+	}
+	if obsClient == nil {
+		return fmt.Errorf("not connected to OBS")
+	}
+
+	if settings.SceneCollection != "" {
+		current, collections, err := obsClient.GetSceneCollectionList()
+		if err != nil {
+			return fmt.Errorf("failed to list OBS scene collections: %w", err)
+		}
+		if err := switchTo("scene collection", settings.SceneCollection, current, collections, obsClient.SetCurrentSceneCollection, cfg.OBSSwitchSettings); err != nil {
+			return err
+		}
+	}
+
+	if settings.Profile != "" {
+		current, profiles, err := obsClient.GetProfileList()
+		if err != nil {
+			return fmt.Errorf("failed to list OBS profiles: %w", err)
+		}
+		if err := switchTo("profile", settings.Profile, current, profiles, obsClient.SetCurrentProfile, cfg.OBSSwitchSettings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// switchTo makes wanted the current OBS item of the given kind if it exists, or only reports
+// that another one is active when apply is false
+func switchTo(kind, wanted, current string, available []string, set func(string) error, apply bool) error {
+	if wanted == current {
+		logging.InfoLogger.Printf("OBS %s %q already active", kind, wanted)
+		return nil
+	}
+	if !apply {
+		return fmt.Errorf("OBS %s is %q, expected %q", kind, current, wanted)
+	}
+	found := false
+	for _, name := range available {
+		if name == wanted {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("OBS %s %q does not exist (available: %v)", kind, wanted, available)
+	}
+	if err := set(wanted); err != nil {
+		return fmt.Errorf("failed to switch OBS %s to %q: %w", kind, wanted, err)
+	}
+	logging.InfoLogger.Printf("Switched OBS %s from %q to %q", kind, current, wanted)
+	return nil
+}
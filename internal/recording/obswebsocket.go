@@ -1,114 +1,859 @@
 package recording
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"os"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
 )
 
+// ErrOBSWebSocketDisabled is returned by Connect when nothing accepts connections on the OBS WebSocket port
+var ErrOBSWebSocketDisabled = errors.New("OBS is running but WebSocket server appears disabled — enable it under Tools → WebSocket Server Settings")
+
+// wsaeConnRefused is the Windows error for a refused connection, which is not syscall.ECONNREFUSED
+const wsaeConnRefused = syscall.Errno(10061)
+
 const (
-	obsWebSocketURL = "ws://localhost:4444"
+	// supportedRPCVersion is the OBS WebSocket RPC version this client implements
+	supportedRPCVersion = 1
+
+	// event categories from the OBS WebSocket protocol, Outputs carries RecordStateChanged
+	eventSubscriptionGeneral = 1 << 0
+	eventSubscriptionConfig  = 1 << 1
+	eventSubscriptionOutputs = 1 << 6
+
+	// obsOutputStopped is the outputState of a RecordStateChanged event once the file is closed
+	obsOutputStopped = "OBS_WEBSOCKET_OUTPUT_STOPPED"
 )
 
+// EventHandler receives the data of an OBS event, on the goroutine reading from OBS
+type EventHandler func(eventData map[string]interface{})
+
 type OBSWebSocketClient struct {
 	conn          *websocket.Conn
 	mu            sync.Mutex
 	requestID     int
-	currentOpChan chan error
+	currentOpChan chan obsResponse
+
+	// requestMu keeps requests from different goroutines from taking each other's responses
+	requestMu sync.Mutex
+
+	// versions announced by the server in its Hello message
+	obsWebSocketVersion string
+	rpcVersion          int
+
+	// recording output state reported by RecordStateChanged events
+	stateMu     sync.Mutex
+	recording   bool
+	recordState string
+	recordPath  string
+
+	// handlers registered with OnEvent, by event type
+	handlersMu sync.Mutex
+	handlers   map[string][]EventHandler
+
+	// connection state shown by the health endpoint
+	statsMu    sync.Mutex
+	connected  bool
+	closing    bool
+	lastError  string
+	reconnects int
+	inFlight   int
 }
 
+// obsResponse carries the outcome of an identify or request operation, requestID is set for the
+// response to a request
+type obsResponse struct {
+	data      map[string]interface{}
+	err       error
+	requestID string
+}
+
+// reconnectInitialBackoff is the wait before the first attempt to restore a lost connection
+const reconnectInitialBackoff = 500 * time.Millisecond
+
 func NewOBSWebSocketClient() *OBSWebSocketClient {
-	return &OBSWebSocketClient{
-		currentOpChan: make(chan error, 1),
+	client := &OBSWebSocketClient{
+		currentOpChan: make(chan obsResponse, 1),
+		handlers:      make(map[string][]EventHandler),
 	}
+	client.OnEvent("RecordStateChanged", client.handleRecordStateChanged)
+	return client
+}
+
+// OnEvent registers a handler for an OBS event type. Handlers must return quickly and must not
+// send requests to OBS, whose responses are read by the same goroutine.
+func (client *OBSWebSocketClient) OnEvent(eventType string, handler EventHandler) {
+	client.handlersMu.Lock()
+	defer client.handlersMu.Unlock()
+	client.handlers[eventType] = append(client.handlers[eventType], handler)
 }
 
+// Connect opens the connection to OBS and identifies with it
 func (client *OBSWebSocketClient) Connect() error {
+	err := client.connect()
+	client.statsMu.Lock()
+	client.connected = err == nil
+	if err != nil {
+		client.lastError = err.Error()
+	}
+	client.statsMu.Unlock()
+	return err
+}
+
+func (client *OBSWebSocketClient) connect() (err error) {
+	cfg := config.GetCurrentConfig()
+	obsWebSocketURL := config.DefaultOBSWebSocketURL
+	if cfg != nil && cfg.OBSWebSocketURL != "" {
+		obsWebSocketURL = cfg.OBSWebSocketURL
+	}
 	u, err := url.Parse(obsWebSocketURL)
 	if err != nil {
 		return fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	// Fail fast instead of blocking startup when OBS is up but its port is firewalled
+	timeout := 5 * time.Second
+	if cfg != nil && cfg.OBSConnectTimeoutSeconds > 0 {
+		timeout = time.Duration(cfg.OBSConnectTimeoutSeconds) * time.Second
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = timeout
+	if u.Scheme == "wss" && cfg != nil {
+		if dialer.TLSClientConfig, err = obsTLSConfig(cfg); err != nil {
+			return err
+		}
+	}
+
+	conn, _, err := dialer.Dial(u.String(), nil)
 	if err != nil {
+		if isTimeout(err) {
+			return fmt.Errorf("timed out after %v connecting to OBS WebSocket at %s, check that OBS is running and the port is not blocked", timeout, obsWebSocketURL)
+		}
+		if isConnectionRefused(err) {
+			return fmt.Errorf("%w (nothing listening at %s)", ErrOBSWebSocketDisabled, obsWebSocketURL)
+		}
 		return fmt.Errorf("failed to connect to OBS WebSocket: %w", err)
 	}
+	// A connection that could not be identified is closed, which also ends its listener
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
 
+	// The Hello and Identified messages must also arrive in time
+	identifyTimeout := timeout
+	if cfg != nil && cfg.OBS.IdentifyTimeoutMs > 0 {
+		identifyTimeout = time.Duration(cfg.OBS.IdentifyTimeoutMs) * time.Millisecond
+	}
+	conn.SetReadDeadline(time.Now().Add(identifyTimeout))
 	client.conn = conn
-	go client.listen()
-	return client.sendIdentify()
+	go client.listen(conn)
+
+	// The server starts with a Hello describing its versions
+	hello := <-client.currentOpChan
+	if hello.err != nil {
+		return fmt.Errorf("failed to receive OBS WebSocket Hello: %w", hello.err)
+	}
+	if err := client.negotiate(hello.data); err != nil {
+		return err
+	}
+
+	if err := client.sendIdentify(); err != nil {
+		return err
+	}
+	if err := (<-client.currentOpChan).err; err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Time{})
+	logging.InfoLogger.Printf("Connected to OBS WebSocket %s (RPC version %d)", client.obsWebSocketVersion, client.rpcVersion)
+	return nil
+}
+
+// obsTLSConfig returns the TLS settings for a wss:// OBS WebSocket address
+func obsTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.OBSTLSSkipVerify}
+	if cfg.OBSCAFile != "" {
+		pem, err := os.ReadFile(cfg.OBSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read OBS CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificate found in OBS CA file %s", cfg.OBSCAFile)
+		}
+	}
+	return tlsConfig, nil
+}
+
+// isTimeout reports whether a connection error is a timeout
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// isConnectionRefused reports whether a connection error means that nothing listens on the port
+func isConnectionRefused(err error) bool {
+	var errno syscall.Errno
+	return errors.As(err, &errno) && (errno == syscall.ECONNREFUSED || errno == wsaeConnRefused)
+}
+
+// negotiate checks the server's Hello and picks the RPC version used to identify
+func (client *OBSWebSocketClient) negotiate(hello map[string]interface{}) error {
+	client.obsWebSocketVersion, _ = hello["obsWebSocketVersion"].(string)
+	serverRPCVersion, _ := hello["rpcVersion"].(float64)
+
+	if int(serverRPCVersion) < supportedRPCVersion {
+		return fmt.Errorf("OBS WebSocket %s uses RPC version %d, version %d or newer is required; update OBS",
+			client.obsWebSocketVersion, int(serverRPCVersion), supportedRPCVersion)
+	}
+	if _, ok := hello["authentication"]; ok {
+		return fmt.Errorf("OBS WebSocket requires a password; disable authentication under Tools, WebSocket Server Settings")
+	}
+
+	// Newer servers support older RPC versions, use the one we implement
+	client.rpcVersion = supportedRPCVersion
+	return nil
 }
 
 func (client *OBSWebSocketClient) sendIdentify() error {
 	identify := map[string]interface{}{
 		"op": 1,
 		"d": map[string]interface{}{
-			"rpcVersion": 1,
+			"rpcVersion":         client.rpcVersion,
+			"eventSubscriptions": eventSubscriptionGeneral | eventSubscriptionConfig | eventSubscriptionOutputs,
 		},
 	}
 	return client.sendMessage(identify)
 }
 
+// sendMessage writes a message to OBS. A request that cannot be written, typically because the
+// connection is half-open, is sent once more on a fresh connection.
 func (client *OBSWebSocketClient) sendMessage(message map[string]interface{}) error {
+	err := client.writeMessage(message)
+	if err == nil || message["op"] != 6 {
+		return err
+	}
+	logging.WarningLogger.Printf("Failed to send request to OBS, reconnecting: %v", err)
+	if reconnectErr := client.reconnect(); reconnectErr != nil {
+		return fmt.Errorf("failed to send request to OBS (%v) and to reconnect: %w", err, reconnectErr)
+	}
+	return client.writeMessage(message)
+}
+
+// writeMessage gives the message a new request ID and writes it on the current connection
+func (client *OBSWebSocketClient) writeMessage(message map[string]interface{}) error {
 	client.mu.Lock()
 	defer client.mu.Unlock()
 
+	if client.conn == nil {
+		return fmt.Errorf("not connected to OBS WebSocket")
+	}
 	client.requestID++
 	message["d"].(map[string]interface{})["requestId"] = fmt.Sprintf("%d", client.requestID)
 	return client.conn.WriteJSON(message)
 }
 
-func (client *OBSWebSocketClient) listen() {
+// reconnectDrainTimeout is how long the listener of a dropped connection is given to report its end
+const reconnectDrainTimeout = time.Second
+
+// reconnect replaces the connection to OBS. It is called with requestMu held, so no request is
+// waiting for a response; what the old listener reports is discarded so that the new connection
+// does not take it for its Hello.
+func (client *OBSWebSocketClient) reconnect() error {
+	// Without a connection yet, OBS was not running when obsreplays started
+	hadConnection := client.conn != nil
+	if hadConnection {
+		client.conn.Close()
+		drain := time.After(reconnectDrainTimeout)
+		for draining := true; draining; {
+			select {
+			case <-client.currentOpChan:
+			case <-drain:
+				draining = false
+			}
+		}
+	}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	httpServer.ReportHealth("obsConnection", nil)
+	if !hadConnection {
+		return nil
+	}
+	client.statsMu.Lock()
+	client.reconnects++
+	client.statsMu.Unlock()
+	logging.InfoLogger.Println("Reconnected to OBS WebSocket")
+	return nil
+}
+
+// keepConnected restores a lost connection in the background, waiting twice as long after each
+// failed attempt up to reconnectMaxBackoffMs. Requests made meanwhile fail or reconnect themselves.
+// failed, if not nil, is told about each attempt that did not connect.
+func (client *OBSWebSocketClient) keepConnected(failed func(error)) {
+	maxBackoff := 30 * time.Second
+	if cfg := config.GetCurrentConfig(); cfg != nil && cfg.OBS.ReconnectMaxBackoffMs > 0 {
+		maxBackoff = time.Duration(cfg.OBS.ReconnectMaxBackoffMs) * time.Millisecond
+	}
+	backoff := reconnectInitialBackoff
+	for {
+		time.Sleep(backoff)
+		client.requestMu.Lock()
+		if client.isClosing() || client.IsConnected() {
+			client.requestMu.Unlock()
+			return
+		}
+		err := client.reconnect()
+		client.requestMu.Unlock()
+		if err == nil {
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		logging.WarningLogger.Printf("Reconnecting to OBS failed, retrying in %v: %v", backoff, err)
+		if failed != nil {
+			failed(err)
+		}
+	}
+}
+
+// IsConnected reports whether the connection to OBS is up, as far as the client knows
+func (client *OBSWebSocketClient) IsConnected() bool {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+	return client.connected
+}
+
+func (client *OBSWebSocketClient) isClosing() bool {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+	return client.closing
+}
+
+// Status describes the connection for the health endpoint
+func (client *OBSWebSocketClient) Status() httpServer.OBSStatus {
+	client.statsMu.Lock()
+	defer client.statsMu.Unlock()
+	return httpServer.OBSStatus{
+		Connected:  client.connected,
+		LastError:  client.lastError,
+		Reconnects: client.reconnects,
+		InFlight:   client.inFlight,
+	}
+}
+
+// listen reads the messages of a connection until it is closed
+func (client *OBSWebSocketClient) listen(conn *websocket.Conn) {
 	for {
-		_, message, err := client.conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
-			client.currentOpChan <- fmt.Errorf("read error: %w", err)
+			client.connectionLost(conn, err)
+			// A response that came too late may still be waiting, do not block on it
+			select {
+			case client.currentOpChan <- obsResponse{err: fmt.Errorf("read error: %w", err)}:
+			default:
+			}
 			return
 		}
 
 		var response map[string]interface{}
 		if err := json.Unmarshal(message, &response); err != nil {
-			client.currentOpChan <- fmt.Errorf("unmarshal error: %w", err)
-			return
+			logging.WarningLogger.Printf("Ignoring OBS WebSocket message that is not a JSON object: %v", err)
+			continue
 		}
 
-		client.handleMessage(response)
+		client.safeHandleMessage(response)
+	}
+}
+
+// connectionLost records the end of a connection that was up and starts restoring it, unless the
+// client is being closed
+func (client *OBSWebSocketClient) connectionLost(conn *websocket.Conn, err error) {
+	client.statsMu.Lock()
+	lost := client.connected && conn == client.conn && !client.closing
+	if lost {
+		client.connected = false
+		client.lastError = err.Error()
 	}
+	client.statsMu.Unlock()
+	if !lost {
+		return
+	}
+	logging.WarningLogger.Printf("Lost connection to OBS WebSocket: %v", err)
+	httpServer.ReportHealth("obsConnection", fmt.Errorf("connection lost: %w", err))
+	go client.keepConnected(nil)
+}
+
+// safeHandleMessage handles a message, logging instead of stopping the listener if it panics
+func (client *OBSWebSocketClient) safeHandleMessage(message map[string]interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.ErrorLogger.Printf("Recovered from panic handling OBS WebSocket message %v: %v", message, r)
+		}
+	}()
+	client.handleMessage(message)
 }
 
+// handleMessage routes a message from OBS. Messages of an unexpected shape, which a newer OBS
+// WebSocket version may send, are logged and skipped rather than stopping the client.
 func (client *OBSWebSocketClient) handleMessage(message map[string]interface{}) {
-	opCode := int(message["op"].(float64))
-	if opCode == 2 {
-		client.currentOpChan <- nil
-	} else if opCode == 7 {
-		status := message["d"].(map[string]interface{})["requestStatus"].(map[string]interface{})
-		if int(status["code"].(float64)) == 100 {
-			client.currentOpChan <- nil
-		} else {
-			client.currentOpChan <- fmt.Errorf("operation failed: %s", status["comment"].(string))
+	op, ok := message["op"].(float64)
+	if !ok {
+		logging.WarningLogger.Printf("Ignoring OBS WebSocket message without op code: %v", message)
+		return
+	}
+	d, _ := message["d"].(map[string]interface{})
+
+	switch int(op) {
+	case 0: // Hello
+		client.currentOpChan <- obsResponse{data: d}
+	case 2: // Identified
+		client.currentOpChan <- obsResponse{}
+	case 5: // Event
+		if d == nil {
+			logging.WarningLogger.Printf("Ignoring OBS event without data: %v", message)
+			return
 		}
+		client.handleEvent(d)
+	case 7: // RequestResponse
+		client.currentOpChan <- requestResponse(d)
+	default:
+		logging.Trace("Unhandled OBS WebSocket op code %v: %v", op, message)
 	}
 }
 
-func (client *OBSWebSocketClient) TriggerHotkey(keyID string) error {
+// requestResponse converts the data of a RequestResponse message into the result of the request
+func requestResponse(d map[string]interface{}) obsResponse {
+	response := requestResult(d)
+	response.requestID, _ = d["requestId"].(string)
+	return response
+}
+
+// requestResult reads the status and data of a RequestResponse message
+func requestResult(d map[string]interface{}) obsResponse {
+	status, ok := d["requestStatus"].(map[string]interface{})
+	if !ok {
+		return obsResponse{err: fmt.Errorf("malformed OBS response: %v", d)}
+	}
+	code, ok := status["code"].(float64)
+	if !ok {
+		return obsResponse{err: fmt.Errorf("malformed OBS response status: %v", status)}
+	}
+	if int(code) != 100 {
+		comment, _ := status["comment"].(string)
+		return obsResponse{err: fmt.Errorf("operation failed: %s", comment)}
+	}
+	data, _ := d["responseData"].(map[string]interface{})
+	return obsResponse{data: data}
+}
+
+// handleEvent routes OBS events to their registered handlers
+func (client *OBSWebSocketClient) handleEvent(d map[string]interface{}) {
+	eventType, _ := d["eventType"].(string)
+	eventData, _ := d["eventData"].(map[string]interface{})
+
+	client.handlersMu.Lock()
+	handlers := client.handlers[eventType]
+	client.handlersMu.Unlock()
+
+	if len(handlers) == 0 {
+		logging.Trace("Unhandled OBS event %s: %v", eventType, eventData)
+		return
+	}
+	for _, handler := range handlers {
+		handler(eventData)
+	}
+}
+
+// handleRecordStateChanged tracks whether OBS is actually recording
+func (client *OBSWebSocketClient) handleRecordStateChanged(eventData map[string]interface{}) {
+	active, _ := eventData["outputActive"].(bool)
+	outputState, _ := eventData["outputState"].(string)
+	outputPath, _ := eventData["outputPath"].(string)
+
+	client.stateMu.Lock()
+	client.recording = active
+	client.recordState = outputState
+	if outputPath != "" {
+		client.recordPath = outputPath
+	}
+	client.stateMu.Unlock()
+
+	logging.InfoLogger.Printf("OBS record state changed: %s (active: %v) %s", outputState, active, outputPath)
+}
+
+// IsRecording reports whether the last RecordStateChanged event said OBS was recording
+func (client *OBSWebSocketClient) IsRecording() bool {
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	return client.recording
+}
+
+// RecordState returns the outputState of the last RecordStateChanged event
+func (client *OBSWebSocketClient) RecordState() string {
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	return client.recordState
+}
+
+// sendRequest sends an OBS request and waits for its response data, at most requestTimeoutMs
+func (client *OBSWebSocketClient) sendRequest(requestType string, requestData map[string]interface{}) (map[string]interface{}, error) {
+	client.statsMu.Lock()
+	client.inFlight++
+	client.statsMu.Unlock()
+	defer func() {
+		client.statsMu.Lock()
+		client.inFlight--
+		client.statsMu.Unlock()
+	}()
+
+	client.requestMu.Lock()
+	defer client.requestMu.Unlock()
+
+	d := map[string]interface{}{
+		"requestType": requestType,
+	}
+	if requestData != nil {
+		d["requestData"] = requestData
+	}
 	request := map[string]interface{}{
 		"op": 6,
-		"d": map[string]interface{}{
-			"requestType": "TriggerHotkeyByKeySequence",
-			"requestData": map[string]interface{}{
-				"keyId": keyID,
-			},
-		},
+		"d":  d,
 	}
 	if err := client.sendMessage(request); err != nil {
-		return err
+		client.recordError(err)
+		return nil, err
+	}
+	requestID, _ := d["requestId"].(string)
+
+	timeout := 10 * time.Second
+	if cfg := config.GetCurrentConfig(); cfg != nil && cfg.OBS.RequestTimeoutMs > 0 {
+		timeout = time.Duration(cfg.OBS.RequestTimeoutMs) * time.Millisecond
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case response := <-client.currentOpChan:
+			if response.requestID != "" && response.requestID != requestID {
+				// The answer to an earlier request that timed out
+				logging.Trace("Discarding late OBS response to request %s", response.requestID)
+				continue
+			}
+			if response.err != nil {
+				client.recordError(response.err)
+			}
+			return response.data, response.err
+		case <-timer.C:
+			err := fmt.Errorf("OBS did not answer %s within %v", requestType, timeout)
+			client.recordError(err)
+			return nil, err
+		}
+	}
+}
+
+// recordError keeps the last error for the health endpoint
+func (client *OBSWebSocketClient) recordError(err error) {
+	client.statsMu.Lock()
+	client.lastError = err.Error()
+	client.statsMu.Unlock()
+}
+
+func (client *OBSWebSocketClient) TriggerHotkey(keyID string) error {
+	_, err := client.sendRequest("TriggerHotkeyByKeySequence", map[string]interface{}{
+		"keyId": keyID,
+	})
+	return err
+}
+
+// GetRecordStatus reports whether the OBS recording output is currently active
+func (client *OBSWebSocketClient) GetRecordStatus() (bool, error) {
+	data, err := client.sendRequest("GetRecordStatus", nil)
+	if err != nil {
+		return false, err
+	}
+	active, _ := data["outputActive"].(bool)
+	return active, nil
+}
+
+// obsFilter describes a filter attached to an OBS source or scene
+type obsFilter struct {
+	Name     string
+	Kind     string
+	Enabled  bool
+	Settings map[string]interface{}
+}
+
+// obsVideoSettings are the canvas and output sizes and the frame rate set in OBS
+type obsVideoSettings struct {
+	BaseWidth, BaseHeight     int
+	OutputWidth, OutputHeight int
+	Fps                       float64
+}
+
+// GetVideoSettings returns the video settings of the current OBS profile
+func (client *OBSWebSocketClient) GetVideoSettings() (obsVideoSettings, error) {
+	data, err := client.sendRequest("GetVideoSettings", nil)
+	if err != nil {
+		return obsVideoSettings{}, err
+	}
+	number := func(key string) float64 {
+		value, _ := data[key].(float64)
+		return value
+	}
+	settings := obsVideoSettings{
+		BaseWidth:    int(number("baseWidth")),
+		BaseHeight:   int(number("baseHeight")),
+		OutputWidth:  int(number("outputWidth")),
+		OutputHeight: int(number("outputHeight")),
+	}
+	if denominator := number("fpsDenominator"); denominator > 0 {
+		settings.Fps = number("fpsNumerator") / denominator
+	}
+	return settings, nil
+}
+
+// GetSourceFilterKindList returns the filter kinds available in OBS, including those added by plugins
+func (client *OBSWebSocketClient) GetSourceFilterKindList() ([]string, error) {
+	data, err := client.sendRequest("GetSourceFilterKindList", nil)
+	if err != nil {
+		return nil, err
+	}
+	return stringList(data, "sourceFilterKinds"), nil
+}
+
+// GetSourceNames returns the names of all scenes and inputs, which can all carry filters
+func (client *OBSWebSocketClient) GetSourceNames() ([]string, error) {
+	var names []string
+
+	data, err := client.sendRequest("GetSceneList", nil)
+	if err != nil {
+		return nil, err
+	}
+	scenes, _ := data["scenes"].([]interface{})
+	for _, scene := range scenes {
+		if s, ok := scene.(map[string]interface{}); ok {
+			if name, ok := s["sceneName"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+
+	data, err = client.sendRequest("GetInputList", nil)
+	if err != nil {
+		return nil, err
+	}
+	inputs, _ := data["inputs"].([]interface{})
+	for _, input := range inputs {
+		if i, ok := input.(map[string]interface{}); ok {
+			if name, ok := i["inputName"].(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+// GetSourceFilterList returns the filters attached to a source or scene
+func (client *OBSWebSocketClient) GetSourceFilterList(sourceName string) ([]obsFilter, error) {
+	data, err := client.sendRequest("GetSourceFilterList", map[string]interface{}{
+		"sourceName": sourceName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var filters []obsFilter
+	list, _ := data["filters"].([]interface{})
+	for _, item := range list {
+		f, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		var filter obsFilter
+		filter.Name, _ = f["filterName"].(string)
+		filter.Kind, _ = f["filterKind"].(string)
+		filter.Enabled, _ = f["filterEnabled"].(bool)
+		filter.Settings, _ = f["filterSettings"].(map[string]interface{})
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// stringList extracts a list of strings from response data
+func stringList(data map[string]interface{}, key string) []string {
+	var values []string
+	list, _ := data[key].([]interface{})
+	for _, item := range list {
+		if value, ok := item.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// GetSceneCollectionList returns the current scene collection and all available ones
+func (client *OBSWebSocketClient) GetSceneCollectionList() (string, []string, error) {
+	data, err := client.sendRequest("GetSceneCollectionList", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	current, _ := data["currentSceneCollectionName"].(string)
+	return current, stringList(data, "sceneCollections"), nil
+}
+
+// SetCurrentSceneCollection switches OBS to another scene collection
+func (client *OBSWebSocketClient) SetCurrentSceneCollection(name string) error {
+	_, err := client.sendRequest("SetCurrentSceneCollection", map[string]interface{}{
+		"sceneCollectionName": name,
+	})
+	return err
+}
+
+// GetProfileList returns the current profile and all available ones
+func (client *OBSWebSocketClient) GetProfileList() (string, []string, error) {
+	data, err := client.sendRequest("GetProfileList", nil)
+	if err != nil {
+		return "", nil, err
+	}
+	current, _ := data["currentProfileName"].(string)
+	return current, stringList(data, "profiles"), nil
+}
+
+// SetCurrentProfile switches OBS to another profile
+func (client *OBSWebSocketClient) SetCurrentProfile(name string) error {
+	_, err := client.sendRequest("SetCurrentProfile", map[string]interface{}{
+		"profileName": name,
+	})
+	return err
+}
+
+// GetSourceScreenshot returns a JPEG image of what a source or scene currently shows
+func (client *OBSWebSocketClient) GetSourceScreenshot(sourceName string, width int) ([]byte, error) {
+	data, err := client.sendRequest("GetSourceScreenshot", map[string]interface{}{
+		"sourceName":              sourceName,
+		"imageFormat":             "jpg",
+		"imageWidth":              width,
+		"imageCompressionQuality": 75,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The image is returned as a data URI
+	imageData, _ := data["imageData"].(string)
+	_, encoded, found := strings.Cut(imageData, ";base64,")
+	if !found {
+		return nil, fmt.Errorf("unexpected screenshot data for %s", sourceName)
 	}
-	return <-client.currentOpChan
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// PauseRecord pauses the OBS recording output
+func (client *OBSWebSocketClient) PauseRecord() error {
+	_, err := client.sendRequest("PauseRecord", nil)
+	return err
+}
+
+// ResumeRecord resumes the paused OBS recording output
+func (client *OBSWebSocketClient) ResumeRecord() error {
+	_, err := client.sendRequest("ResumeRecord", nil)
+	return err
+}
+
+// GetCurrentProgramScene returns the name of the scene on program
+func (client *OBSWebSocketClient) GetCurrentProgramScene() (string, error) {
+	data, err := client.sendRequest("GetCurrentProgramScene", nil)
+	if err != nil {
+		return "", err
+	}
+	name, _ := data["currentProgramSceneName"].(string)
+	return name, nil
+}
+
+// GetSceneItemID returns the id of a source in a scene
+func (client *OBSWebSocketClient) GetSceneItemID(scene, source string) (int, error) {
+	data, err := client.sendRequest("GetSceneItemId", map[string]interface{}{
+		"sceneName":  scene,
+		"sourceName": source,
+	})
+	if err != nil {
+		return 0, err
+	}
+	id, ok := data["sceneItemId"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("no id for source %s in scene %s", source, scene)
+	}
+	return int(id), nil
+}
+
+// SetSceneItemEnabled shows or hides a source of a scene
+func (client *OBSWebSocketClient) SetSceneItemEnabled(scene string, id int, enabled bool) error {
+	_, err := client.sendRequest("SetSceneItemEnabled", map[string]interface{}{
+		"sceneName":        scene,
+		"sceneItemId":      id,
+		"sceneItemEnabled": enabled,
+	})
+	return err
+}
+
+// GetReplayBufferStatus reports whether the OBS replay buffer is running
+func (client *OBSWebSocketClient) GetReplayBufferStatus() (bool, error) {
+	data, err := client.sendRequest("GetReplayBufferStatus", nil)
+	if err != nil {
+		return false, err
+	}
+	active, _ := data["outputActive"].(bool)
+	return active, nil
+}
+
+// StartReplayBuffer starts the OBS replay buffer
+func (client *OBSWebSocketClient) StartReplayBuffer() error {
+	_, err := client.sendRequest("StartReplayBuffer", nil)
+	return err
+}
+
+// SaveReplayBuffer asks OBS to write the contents of the replay buffer to a file
+func (client *OBSWebSocketClient) SaveReplayBuffer() error {
+	_, err := client.sendRequest("SaveReplayBuffer", nil)
+	return err
+}
+
+// GetLastReplayBufferReplay returns the path of the last file saved from the replay buffer
+func (client *OBSWebSocketClient) GetLastReplayBufferReplay() (string, error) {
+	data, err := client.sendRequest("GetLastReplayBufferReplay", nil)
+	if err != nil {
+		return "", err
+	}
+	path, _ := data["savedReplayPath"].(string)
+	return path, nil
 }
 
 func (client *OBSWebSocketClient) Close() error {
+	client.statsMu.Lock()
+	client.closing = true
+	client.connected = false
+	client.statsMu.Unlock()
+	if client.conn == nil {
+		return nil
+	}
 	return client.conn.Close()
 }
@@ -0,0 +1,114 @@
+package recording
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/owlcms/obsreplays/internal/config"
+)
+
+// reservedNames are the replays being filed, by directory and base name, so that attempts filed at
+// the same time cannot get the same name before either has written its files
+var (
+	reservedMu    sync.Mutex
+	reservedNames = map[string]bool{}
+)
+
+// reserveBaseName returns base, or base with a numbered suffix when a replay with that name is in
+// dir or being filed there, and keeps the name until releaseBaseName
+func reserveBaseName(dir, base string) string {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+	name := freeName(base, dir)
+	reservedNames[filepath.Join(dir, name)] = true
+	return name
+}
+
+// releaseBaseName frees a name returned by reserveBaseName once its files are written
+func releaseBaseName(dir, base string) {
+	reservedMu.Lock()
+	delete(reservedNames, filepath.Join(dir, base))
+	reservedMu.Unlock()
+}
+
+// replayNames returns the session directory and the base file name of a replay. The session folder
+// is named by config.FitSessionName; when the longest file of the replay, whose name is the base
+// followed by suffixLength characters, would still not fit in limit characters, the athlete name is
+// shortened. truncated reports when either was shortened.
+func replayNames(videoDir, session, timestamp, athlete, liftType string, attempt, suffixLength, limit int) (sessionDir, baseFileName string, truncated bool) {
+	sessionName, truncated := config.FitSessionName(videoDir, session, limit)
+	sessionDir = filepath.Join(videoDir, sessionName)
+	athlete = strings.ReplaceAll(athlete, " ", "_")
+	fixedPart := fmt.Sprintf("%s__%s_attempt%d", timestamp, liftType, attempt)
+
+	room := limit - len(sessionDir) - 1 - len(fixedPart) - suffixLength
+	if room > config.MaxNameLength-len(fixedPart)-suffixLength {
+		room = config.MaxNameLength - len(fixedPart) - suffixLength
+	}
+	if len(athlete) > room {
+		athlete = config.ShortenName(athlete, room)
+		truncated = true
+	}
+	baseFileName = fmt.Sprintf("%s_%s_%s_attempt%d", timestamp, athlete, liftType, attempt)
+	return sessionDir, baseFileName, truncated
+}
+
+// cameraID returns the identifier of the camera that recorded a file in the captures directory,
+// with characters that would break the replay names replaced
+func cameraID(fileName string) (string, bool) {
+	// Replays and highlight reels are never camera files, even when cameraFilePattern matches them
+	if name := filepath.Base(fileName); replayFileRegexp.MatchString(name) || strings.HasSuffix(name, "_highlights.mp4") {
+		return "", false
+	}
+	matches := config.GetCurrentConfig().CameraFileRegexp().FindStringSubmatch(filepath.Base(fileName))
+	if matches == nil || matches[1] == "" {
+		return "", false
+	}
+	return strings.NewReplacer(" ", "-", "_", "-").Replace(matches[1]), true
+}
+
+// longestSuffix returns the length of the longest suffix added to the base file name of a replay
+func longestSuffix(cameraNums []string, cfg *config.Config) int {
+	longest := len(".json")
+	for _, cameraNum := range cameraNums {
+		suffixes := []string{
+			fmt.Sprintf("_Camera%s.mp4", cameraNum),
+			fmt.Sprintf("_Camera%s_vertical.mp4", cameraNum),
+		}
+		for _, profile := range cfg.Profiles {
+			suffixes = append(suffixes, fmt.Sprintf("_Camera%s_%s.%s", cameraNum, profile.Name, profile.Format))
+		}
+		for _, suffix := range suffixes {
+			if len(suffix) > longest {
+				longest = len(suffix)
+			}
+		}
+	}
+	return longest
+}
+
+// CheckVideoDir rejects a videoDir that is the OBS captures directory or inside it, where replays
+// and camera files would be mixed up
+func CheckVideoDir() error {
+	videoDir, captureDir := config.GetVideoDir(), GetCaptureDir()
+	if pathWithin(videoDir, captureDir) {
+		return fmt.Errorf("videoDir %s is inside the OBS captures directory %s, choose a folder outside it", videoDir, captureDir)
+	}
+	return nil
+}
+
+// pathWithin reports whether dir is parent or one of its subdirectories, ignoring case on Windows
+func pathWithin(dir, parent string) bool {
+	dir, parent = filepath.Clean(dir), filepath.Clean(parent)
+	if runtime.GOOS == "windows" {
+		dir, parent = strings.ToLower(dir), strings.ToLower(parent)
+	}
+	rel, err := filepath.Rel(parent, dir)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
@@ -0,0 +1,114 @@
+package recording
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+)
+
+func TestReplayNamesFitPathLimit(t *testing.T) {
+	longSession := strings.Repeat("International_Weightlifting_Federation_Masters_", 6)
+	longAthlete := strings.Repeat("Maximiliano_Alejandro_de_la_Vega_", 5)
+	videoDir := filepath.Join("C:", "Users", "operator", "AppData", "Roaming", "obsreplays", "videos")
+	suffix := len("_Camera12_vertical.mp4")
+
+	tests := []struct {
+		name     string
+		session  string
+		athlete  string
+		truncate bool
+	}{
+		{"short names", "A1", "Jane Doe", false},
+		{"long athlete", "A1", longAthlete, true},
+		{"long session", longSession, "Jane Doe", true},
+		{"long session and athlete", longSession, longAthlete, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, base, truncated := replayNames(videoDir, tt.session, "2024-12-31_23h59m58s",
+				tt.athlete, "CLEANJERK", 2, suffix, config.WindowsMaxPath)
+			if truncated != tt.truncate {
+				t.Errorf("truncated = %v, want %v", truncated, tt.truncate)
+			}
+			if n := len(filepath.Join(dir, base)) + suffix; n > config.WindowsMaxPath {
+				t.Errorf("path is %d characters, limit is %d: %s", n, config.WindowsMaxPath, filepath.Join(dir, base))
+			}
+			if !strings.HasSuffix(base, "_CLEANJERK_attempt2") || !strings.HasPrefix(base, "2024-12-31_23h59m58s_") {
+				t.Errorf("base name %q lost its timestamp, lift or attempt", base)
+			}
+		})
+	}
+}
+
+func TestShortenKeepsNamesDistinct(t *testing.T) {
+	prefix := strings.Repeat("x", 100)
+	a := config.ShortenName(prefix+"Smith", 40)
+	b := config.ShortenName(prefix+"Jones", 40)
+	if a == b {
+		t.Errorf("different names shortened to the same %q", a)
+	}
+	if len(a) > 40 {
+		t.Errorf("shortened name is %d bytes, want at most 40", len(a))
+	}
+	if config.ShortenName(prefix+"Smith", 40) != a {
+		t.Errorf("shortening is not deterministic")
+	}
+	if s := config.ShortenName(strings.Repeat("é", 30), 20); len(s) > 20 || !strings.HasPrefix(s, "é") {
+		t.Errorf("shortening cut a character in half: %q", s)
+	}
+}
+
+func TestCameraIDSkipsReplays(t *testing.T) {
+	loadTestConfig(t, `recordingFormat = "mp4"`)
+	tests := []struct {
+		file   string
+		camera string
+	}{
+		{"2024-12-31 23-59-58 Camera1.mp4", "1"},
+		{"Camera 2.mp4", "-2"},
+		{"2024-12-31_23h59m58s_Jane_Doe_SNATCH_attempt1_Camera1.mp4", ""},
+		{"2024-12-31_23h59m58s_Jane_Doe_SNATCH_attempt1_Camera1_vertical.mp4", ""},
+		{"A1_highlights.mp4", ""},
+	}
+	for _, tt := range tests {
+		camera, _ := cameraID(tt.file)
+		if camera != tt.camera {
+			t.Errorf("cameraID(%q) = %q, want %q", tt.file, camera, tt.camera)
+		}
+	}
+}
+
+func TestPathWithin(t *testing.T) {
+	captures := filepath.Join("home", "operator", "Videos", "Captures")
+	tests := []struct {
+		dir  string
+		want bool
+	}{
+		{captures, true},
+		{filepath.Join(captures, "replays"), true},
+		{filepath.Join("home", "operator", "Videos"), false},
+		{filepath.Join("home", "operator", "Videos", "CapturesReplays"), false},
+		{filepath.Join("home", "operator", "replays"), false},
+	}
+	for _, tt := range tests {
+		if got := pathWithin(tt.dir, captures); got != tt.want {
+			t.Errorf("pathWithin(%q) = %v, want %v", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestSessionDirNameMatchesReplays(t *testing.T) {
+	loadTestConfig(t, "")
+	longSession := strings.Repeat("International Weightlifting Federation Masters ", 10)
+	for _, session := range []string{"A1", "", longSession} {
+		// As filed by the pipeline, and as looked up by the listing, playlists and reassignment
+		dir, _, _ := replayNames(config.DatedVideoDir(time.Now()), session, "2024-12-31_23h59m58s",
+			"Jane Doe", "SNATCH", 1, len("_Camera1.mp4"), config.PathLimit())
+		if want := config.SessionDirName(session); filepath.Base(dir) != want {
+			t.Errorf("replays of %q filed in %q, session folder is %q", session, filepath.Base(dir), want)
+		}
+	}
+}
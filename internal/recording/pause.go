@@ -0,0 +1,142 @@
+package recording
+
+import (
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// When pauseOnClockStop is set, the OBS recording is paused while the clock stays stopped without
+// a decision (jury, bar reload) and resumed when the clock restarts for the same attempt. The
+// clock also stops when the athlete lifts, so the pause only happens after pauseAfterMs.
+
+// pauseInterval is a time the recording was paused, wall-clock milliseconds
+type pauseInterval struct {
+	start, end int64
+}
+
+var (
+	pauseMu sync.Mutex
+	// pauseTimer pauses the recording when the clock stays stopped
+	pauseTimer *time.Timer
+	// pausedAt is when the recording was paused in milliseconds, 0 when it is not paused
+	pausedAt int64
+	// pauses are the times the current recording was paused and resumed
+	pauses []pauseInterval
+	// the attempt being recorded, and the clock start time of its recording
+	pauseAthlete  string
+	pauseAttempt  int
+	pauseStart    int64
+	pauseTracking bool
+)
+
+// trackPauses remembers the attempt that just started recording
+func trackPauses() {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	stopPauseTimer()
+	pausedAt, pauses = 0, nil
+	pauseAthlete, pauseAttempt, pauseStart = state.CurrentAthlete, state.CurrentAttempt, state.LastStartTime
+	pauseTracking = true
+}
+
+// ClockStopped pauses the recording if the clock is not restarted and no decision is given
+// within pauseAfterMs
+func ClockStopped() {
+	cfg := config.GetCurrentConfig()
+	if !cfg.PauseOnClockStop || usingReplayBuffer() {
+		return
+	}
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if !pauseTracking || pausedAt != 0 {
+		return
+	}
+	stopPauseTimer()
+	pauseTimer = time.AfterFunc(time.Duration(cfg.PauseAfterMs)*time.Millisecond, pauseRecording)
+}
+
+// pauseRecording pauses the OBS recording while the clock is stopped
+func pauseRecording() {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if !pauseTracking || pausedAt != 0 {
+		return
+	}
+	if err := obsClient.PauseRecord(); err != nil {
+		logging.WarningLogger.Printf("Failed to pause OBS recording: %v", err)
+		return
+	}
+	pausedAt = time.Now().UnixNano() / int64(time.Millisecond)
+	logging.InfoLogger.Printf("Clock stopped without a decision, paused recording of %s", pauseAthlete)
+}
+
+// resumeRecording continues the recording when the clock restarts for the attempt being recorded,
+// and reports whether it did. The start time of the recording is kept for the trim.
+func resumeRecording(log *logging.AttemptLogger) bool {
+	if !config.GetCurrentConfig().PauseOnClockStop {
+		return false
+	}
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	if !pauseTracking || state.CurrentAthlete != pauseAthlete || state.CurrentAttempt != pauseAttempt {
+		return false
+	}
+	stopPauseTimer()
+	if pausedAt != 0 {
+		if err := obsClient.ResumeRecord(); err != nil {
+			log.Warning("Failed to resume OBS recording: %v", err)
+			return false
+		}
+		resumedAt := time.Now().UnixNano() / int64(time.Millisecond)
+		pauses = append(pauses, pauseInterval{start: pausedAt, end: resumedAt})
+		log.Info("Clock restarted, resumed recording after a %.1fs pause", float64(resumedAt-pausedAt)/1000)
+		pausedAt = 0
+	} else {
+		log.Info("Clock restarted, recording continues")
+	}
+	state.LastStartTime = pauseStart
+	return true
+}
+
+// endPauses stops tracking the recording and returns the times it was paused
+func endPauses() []pauseInterval {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	stopPauseTimer()
+	ended := pauses
+	if pausedAt != 0 {
+		// Stopped while paused, the rest of the wall clock time was not recorded either
+		ended = append(ended, pauseInterval{start: pausedAt, end: time.Now().UnixNano() / int64(time.Millisecond)})
+	}
+	pausedAt, pauses = 0, nil
+	pauseTracking = false
+	return ended
+}
+
+// pausedBefore returns how long the recording was paused before the wall-clock time at, in
+// milliseconds: only that part of the pauses moves the moment at in the recording
+func pausedBefore(pauses []pauseInterval, at int64) int64 {
+	var total int64
+	for _, pause := range pauses {
+		end := pause.end
+		if end > at {
+			end = at
+		}
+		if end > pause.start {
+			total += end - pause.start
+		}
+	}
+	return total
+}
+
+// stopPauseTimer cancels a pending pause, pauseMu must be held
+func stopPauseTimer() {
+	if pauseTimer != nil {
+		pauseTimer.Stop()
+		pauseTimer = nil
+	}
+}
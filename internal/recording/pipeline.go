@@ -0,0 +1,731 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+var (
+	// pendingJobs tracks recordings being processed in the background
+	pendingJobs sync.WaitGroup
+
+	// jobSlots limits how many recordings are trimmed and filed at the same time
+	jobSlots     chan struct{}
+	jobSlotsOnce sync.Once
+
+	// busyMu guards the work directories and camera files of the recordings being processed, with
+	// the number of jobs using them, which a reset must leave alone
+	busyMu       sync.Mutex
+	busyWorkDirs = map[string]int{}
+	busySources  = map[string]int{}
+)
+
+// trimmedDirName is the folder of the work directory where trimmed videos are written
+const trimmedDirName = "trimmed"
+
+// salvageDirName is the folder of the captures directory where a reset moves the camera files left over
+const salvageDirName = "salvage"
+
+// noLiftsDirName is the folder of the session directory holding the replays of no lifts when
+// recordOnlyGoodLifts keeps them
+const noLiftsDirName = "nolifts"
+
+// recordingJob is a snapshot of an attempt's context and camera files, so that it can be
+// trimmed and filed while the next attempt is being recorded
+type recordingJob struct {
+	athlete       string
+	liftType      string
+	attempt       int
+	weight        int
+	session       string
+	startTime     int64
+	timerStopTime int64
+	decisionTime  int64
+	clipStart     int64
+	pauses        []pauseInterval
+	keepAll       bool // stopped at the time limit, nothing is trimmed
+	decision      string
+	fields        map[string]string
+	bookmarks     []int64
+	expected      []string
+	workDir       string
+	sourceFiles   []string
+	log           *logging.AttemptLogger
+	processed     bool // endProcessing was called
+	pipeline      int  // id of the attempt in the pipeline state, 0 when not followed
+}
+
+// newRecordingJob captures the current attempt from state
+func newRecordingJob(workDir string, sourceFiles []string, decisionTime int64, bookmarks []int64) *recordingJob {
+	return &recordingJob{
+		athlete:       state.CurrentAthlete,
+		liftType:      state.CurrentLiftType,
+		attempt:       state.CurrentAttempt,
+		weight:        state.CurrentWeight,
+		session:       state.CurrentSession,
+		startTime:     state.LastStartTime,
+		timerStopTime: state.LastTimerStopTime,
+		decisionTime:  decisionTime,
+		decision:      state.LastDecision,
+		fields:        state.CurrentFields,
+		bookmarks:     bookmarks,
+		expected:      state.ExpectedCameras,
+		workDir:       workDir,
+		sourceFiles:   sourceFiles,
+		log:           logging.ForAttempt(state.CurrentAthlete, state.CurrentLiftType, state.CurrentAttempt, state.CurrentSession),
+	}
+}
+
+// attemptInfo describes the attempt for status messages
+func (job *recordingJob) attemptInfo() string {
+	return describeAttempt(job.athlete, job.liftType, job.attempt)
+}
+
+// describeAttempt is attemptInfo before the job is created
+func describeAttempt(athlete, liftType string, attempt int) string {
+	return fmt.Sprintf("%s - %s attempt %d",
+		strings.ReplaceAll(athlete, "_", " "),
+		liftType,
+		attempt)
+}
+
+// origin returns the wall-clock time in milliseconds at which the recording begins: recordings
+// begin at the start of the attempt, replay buffer clips at clipStart
+func (job *recordingJob) origin() int64 {
+	if job.clipStart != 0 {
+		return job.clipStart
+	}
+	return job.startTime
+}
+
+// trimDuration returns how many milliseconds to remove from the start of the recording, 0 keeps it all
+func (job *recordingJob) trimDuration() int64 {
+	if job.startTime == 0 {
+		// The recorder was started mid-attempt and never saw the clock start
+		job.log.Warning("Start time unavailable, keeping the full recording")
+		return 0
+	}
+	origin := job.origin()
+	if job.keepAll {
+		job.log.Warning("Stopped at the time limit, keeping the full recording")
+		return job.startTime - origin
+	}
+	if job.timerStopTime == 0 {
+		// owlcms gave a decision without the clock being stopped, or the stop was never received.
+		// Without a decision either (crash recovery, local trigger, time limit) nothing places the lift.
+		if config.GetCurrentConfig().MissingTimerStop == config.MissingTimerStopFull || job.decisionTime == NoDecision {
+			job.log.Warning("Timer stop missing, keeping the full recording")
+			return job.startTime - origin
+		}
+		job.log.Warning("Timer stop missing, trimming relative to the decision")
+		return job.decisionTime - origin - pausedBefore(job.pauses, job.decisionTime) - 5000
+	}
+	// Time spent paused before the stop is not in the recording
+	return job.timerStopTime - origin - pausedBefore(job.pauses, job.timerStopTime) - 5000
+}
+
+// clipBookmarks returns the bookmarks as positions in the recording, in milliseconds: like the trim
+// reference, a mark is moved back by the time the recording was paused before it
+func (job *recordingJob) clipBookmarks() []int64 {
+	marks := make([]int64, len(job.bookmarks))
+	for i, mark := range job.bookmarks {
+		marks[i] = mark - pausedBefore(job.pauses, job.origin()+mark)
+	}
+	return marks
+}
+
+// nameWithFields returns the athlete name followed by the values of the given owlcms fields, with
+// characters not allowed in file names replaced. "weight" and "result" give the attempted weight
+// and the decision. Fields owlcms did not send are skipped.
+func (job *recordingJob) nameWithFields(names []string) string {
+	name := job.athlete
+	for _, field := range names {
+		value := strings.TrimSpace(job.fields[field])
+		switch field {
+		case "weight":
+			if job.weight > 0 {
+				value = fmt.Sprintf("%dkg", job.weight)
+			}
+		case "result":
+			value = job.decision
+		}
+		if value == "" {
+			continue
+		}
+		name += "_" + strings.Map(func(r rune) rune {
+			if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+				return '-'
+			}
+			return r
+		}, value)
+	}
+	return name
+}
+
+// missingCameras returns the expected cameras for which no file was found
+func (job *recordingJob) missingCameras(found []string) []string {
+	return missingFrom(job.expected, found)
+}
+
+// missingFrom returns the expected cameras that are not in found
+func missingFrom(expected, found []string) []string {
+	var missing []string
+	for _, camera := range expected {
+		present := false
+		for _, f := range found {
+			if f == camera {
+				present = true
+				break
+			}
+		}
+		if !present {
+			missing = append(missing, camera)
+		}
+	}
+	return missing
+}
+
+// acquireSlot waits until fewer than maxConcurrentJobs recordings are being processed,
+// and returns the function that frees the slot
+func (job *recordingJob) acquireSlot() func() {
+	return takeSlot(func(running int) { job.log.Info("Processing queued, %d job(s) running", running) })
+}
+
+// takeSlot waits for one of the maxConcurrentJobs processing slots, shared by recordings, highlights
+// exports and backfills, calling queued first if none is free. It returns the function that frees
+// the slot.
+func takeSlot(queued func(running int)) func() {
+	jobSlotsOnce.Do(func() {
+		if n := config.GetCurrentConfig().MaxConcurrentJobs; n > 0 {
+			jobSlots = make(chan struct{}, n)
+		}
+	})
+	if jobSlots == nil {
+		return func() {}
+	}
+
+	select {
+	case jobSlots <- struct{}{}:
+	default:
+		queued(len(jobSlots))
+		jobSlots <- struct{}{}
+	}
+	return func() { <-jobSlots }
+}
+
+// holdFiles marks the work directory and camera files of the job as in use until releaseFiles
+func (job *recordingJob) holdFiles() {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	busyWorkDirs[job.workDir]++
+	for _, sourceFile := range job.sourceFiles {
+		busySources[sourceFile]++
+	}
+}
+
+// releaseFiles undoes holdFiles
+func (job *recordingJob) releaseFiles() {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	if busyWorkDirs[job.workDir]--; busyWorkDirs[job.workDir] <= 0 {
+		delete(busyWorkDirs, job.workDir)
+	}
+	for _, sourceFile := range job.sourceFiles {
+		if busySources[sourceFile]--; busySources[sourceFile] <= 0 {
+			delete(busySources, sourceFile)
+		}
+	}
+}
+
+// workDirInUse reports whether a recording is processed in dir
+func workDirInUse(dir string) bool {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	return busyWorkDirs[dir] > 0
+}
+
+// sourceInUse reports whether a camera file is being processed
+func sourceInUse(fileName string) bool {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	return busySources[fileName] > 0
+}
+
+// timingInUse reports whether a timing file belongs to a camera file being processed
+func timingInUse(fileName string) bool {
+	busyMu.Lock()
+	defer busyMu.Unlock()
+	for sourceFile := range busySources {
+		if timingFile(sourceFile) == fileName {
+			return true
+		}
+	}
+	return false
+}
+
+// run processes the job in the background or waits for it, as configured
+func (job *recordingJob) run() error {
+	if config.GetCurrentConfig().BackgroundProcessing {
+		err := processInBackground(job)
+		if err == nil {
+			return nil
+		}
+		// The camera files are back in place, or left where they were moved, process them now
+		job.log.Warning("%v, processing without waiting for the next attempt", err)
+	}
+	return job.process()
+}
+
+// process trims the camera files into the session directory and removes the sources
+func (job *recordingJob) process() (err error) {
+	// The post-record command also runs for discarded and failed attempts, so that what the
+	// pre-record command turned on is reset
+	hookStatus := hookReady
+	defer func() {
+		if err != nil {
+			hookStatus = hookFailed
+		}
+		job.postRecordHook(hookStatus)
+	}()
+	defer func() { httpServer.EndPipeline(job.pipeline, err) }()
+	httpServer.SetPipelineStage(job.pipeline, httpServer.StageTrimming)
+	job.beginProcessing()
+	defer job.endProcessing("")
+	job.holdFiles()
+	defer job.releaseFiles()
+	release := job.acquireSlot()
+	defer release()
+
+	cfg := config.GetCurrentConfig()
+	var trimDuration int64
+	if cfg.FixedDuration == 0 {
+		trimDuration = job.trimDuration()
+	}
+
+	var cameraSources, cameraNums []string
+	for _, sourceFile := range job.sourceFiles {
+		if cameraNum, ok := cameraID(sourceFile); ok {
+			cameraSources = append(cameraSources, sourceFile)
+			cameraNums = append(cameraNums, cameraNum)
+		}
+	}
+
+	if len(cameraSources) == 0 {
+		return fmt.Errorf("no camera file among %v, check cameraFilePattern", job.sourceFiles)
+	}
+
+	missing := job.missingCameras(cameraNums)
+	if len(missing) > 0 {
+		job.log.Warning("Expected camera(s) %v, no file found for camera(s) %v", job.expected, missing)
+	}
+
+	// Create session directory for final copies, with names that fit the platform path limit
+	limit := config.PathLimit()
+	now := time.Now()
+	suffixLength := longestSuffix(cameraNums, cfg)
+	liftTypeDir := ""
+	if cfg.LiftTypeFolders && job.session != "" {
+		// Unsorted replays stay together until they are reassigned to a session
+		liftTypeDir = config.LiftTypeDir(job.liftType)
+		suffixLength += len(liftTypeDir) + 1
+	}
+	noLift := cfg.RecordOnlyGoodLifts && job.decision == state.DecisionBad
+	if noLift && cfg.NoLiftAction != config.NoLiftDiscard {
+		suffixLength += len(noLiftsDirName) + 1
+	}
+	fullSessionDir, baseFileName, truncated := replayNames(config.DatedVideoDir(now), job.session,
+		config.FormatTimestamp(now), job.nameWithFields(cfg.FileNameFields), job.liftType, job.attempt,
+		suffixLength, limit)
+	sessionDir := fullSessionDir
+	fullSessionDir = filepath.Join(fullSessionDir, liftTypeDir)
+	if truncated {
+		job.log.Warning("Shortened replay names to fit the %d character path limit: %s",
+			limit, filepath.Join(fullSessionDir, baseFileName))
+	}
+	if noLift && cfg.NoLiftAction == config.NoLiftDiscard {
+		hookStatus = hookDiscarded
+		return job.discard(fullSessionDir, baseFileName)
+	}
+	if noLift {
+		fullSessionDir = filepath.Join(fullSessionDir, noLiftsDirName)
+		job.log.Info("No lift, filing the replay in %s", fullSessionDir)
+	}
+	// MkdirAll succeeds when another attempt created the directory first
+	if err := os.MkdirAll(fullSessionDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	// Timestamps are to the second, attempts stopped back to back may be filed in the same one
+	if name := reserveBaseName(fullSessionDir, baseFileName); name != baseFileName {
+		job.log.Warning("Replay %s already exists, filing this one as %s", baseFileName, name)
+		baseFileName = name
+	}
+	defer releaseBaseName(fullSessionDir, baseFileName)
+
+	// A camera that fails is reported and its recording kept for salvage, the others are still filed
+	var finalFiles, failedCameras, failedSources []string
+	for i, sourceFile := range cameraSources {
+		cameraNum := cameraNums[i]
+		cameraTrim := trimDuration
+		if cfg.FixedDuration == 0 && job.startTime != 0 {
+			cameraTrim = job.alignedTrim(sourceFile, cameraNum, trimDuration, job.origin())
+		}
+		files, err := job.processCamera(cfg, sourceFile, cameraNum, fullSessionDir, baseFileName, cameraTrim)
+		finalFiles = append(finalFiles, files...)
+		if len(files) == 0 {
+			httpServer.SetCameraProgress(job.pipeline, cameraNum, httpServer.StageFailed, 0)
+		} else {
+			httpServer.SetCameraProgress(job.pipeline, cameraNum, httpServer.StageDone, 100)
+		}
+		if err == nil {
+			continue
+		}
+		if len(files) > 0 {
+			// The replay itself was filed, only an additional output is missing
+			job.log.Error("Camera %s: %v", cameraNum, err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+			continue
+		}
+		if len(finalFiles) == 0 && i == len(cameraSources)-1 {
+			// Nothing could be filed, the recordings stay where they are
+			return err
+		}
+		job.log.Error("Camera %s failed, filing the other cameras: %v", cameraNum, err)
+		httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+		failedCameras = append(failedCameras, cameraNum)
+		failedSources = append(failedSources, sourceFile)
+	}
+
+	// In fixed duration mode what was trimmed depends on the length of the recording
+	leadIn := trimDuration
+	if cfg.FixedDuration > 0 && len(job.bookmarks) > 0 {
+		if recorded, err := probeDuration(job.sourceFiles[0]); err != nil {
+			job.log.Warning("Could not determine duration of %s: %v", job.sourceFiles[0], err)
+		} else {
+			leadIn = int64(recorded*1000) - int64(cfg.FixedDuration)*1000
+		}
+	}
+	if leadIn < 0 {
+		leadIn = 0
+	}
+
+	// Final pass: delete, archive or keep the original camera files
+
+	// wait 5 seconds
+	time.Sleep(5 * time.Second)
+
+	job.disposeSources(fullSessionDir, baseFileName, failedSources)
+
+	// Report the actual clip length, which may differ from the computed one if the trim was clamped
+	readyText := "Videos ready"
+	if len(finalFiles) > 0 {
+		if clipDuration, err := probeDuration(finalFiles[0]); err != nil {
+			job.log.Warning("Could not determine duration of %s: %v", finalFiles[0], err)
+		} else {
+			readyText = fmt.Sprintf("Videos ready: %s - %.1fs clip, %.1fs lead-in trimmed",
+				job.attemptInfo(), clipDuration, float64(leadIn)/1000)
+			if cfg.FixedDuration > 0 {
+				readyText = fmt.Sprintf("Videos ready: %s - %.1fs clip, last %ds kept",
+					job.attemptInfo(), clipDuration, cfg.FixedDuration)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		readyText += fmt.Sprintf(" (missing Camera %s)", strings.Join(missing, ", "))
+	}
+	if len(failedCameras) > 0 {
+		readyText += fmt.Sprintf(" (failed Camera %s)", strings.Join(failedCameras, ", "))
+	}
+	if noLift {
+		readyText += " (no lift)"
+	}
+
+	manifestFile := filepath.Join(fullSessionDir, baseFileName+".json")
+	if err := writeManifest(manifestFile, types.ReplayManifest{
+		Athlete:  job.athlete,
+		LiftType: job.liftType,
+		Attempt:  job.attempt,
+		Weight:   job.weight,
+		Session:  job.session,
+		Decision: job.decision,
+		Created:  time.Now(),
+		Files:    finalFiles,
+		Fields:   job.fields,
+		Chapters: bookmarkChapters(job.clipBookmarks(), leadIn),
+	}); err != nil {
+		job.log.Warning("Failed to write manifest %s: %v", manifestFile, err)
+	}
+	updateSessionIndex(sessionDir)
+
+	state.ClearRecordingInProgress(job.startTime)
+
+	job.endProcessing(readyText)
+	job.log.Info("Processed videos: %v", finalFiles)
+	notifyReady(job.log)
+
+	// The replay is ready once in the videos directory, the archive copy may take longer
+	archiveReplay(job.log, append(finalFiles, manifestFile))
+	return nil
+}
+
+// processCamera trims the recording of one camera into the session directory and produces its
+// additional outputs, returning the files produced even when a later step fails
+func (job *recordingJob) processCamera(cfg *config.Config, sourceFile, cameraNum, fullSessionDir, baseFileName string, trimDuration int64) ([]string, error) {
+	var files []string
+	finalFileName := filepath.Join(fullSessionDir, fmt.Sprintf("%s_Camera%s.mp4", baseFileName, cameraNum))
+
+	// In single pass mode ffmpeg writes the final file directly, otherwise the trimmed file is
+	// written next to the captures and moved to the session directory. It goes in its own folder
+	// so that it is not taken for a camera file when OBS also records mp4.
+	trimmedFile := finalFileName
+	if !cfg.SinglePassTrim {
+		trimmedDir := filepath.Join(job.workDir, trimmedDirName)
+		if err := os.MkdirAll(trimmedDir, os.ModePerm); err != nil {
+			return files, fmt.Errorf("failed to create %s: %w", trimmedDir, err)
+		}
+		trimmedFile = filepath.Join(trimmedDir, fmt.Sprintf("Camera%s.mp4", cameraNum))
+	}
+
+	// Process video trimming
+	httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Trimming video for Camera %s: %s", cameraNum, job.attemptInfo()))
+
+	httpServer.SetCameraProgress(job.pipeline, cameraNum, httpServer.StageTrimming, 0)
+
+	// The length of the replay gives the progress of the trim, unknown if the recording cannot be probed
+	recorded, probeErr := probeDuration(sourceFile)
+	clipSeconds := recorded - float64(trimDuration)/1000
+	args := job.trimmingArgs(cfg, trimDuration, clipSeconds, probeErr == nil, sourceFile, trimmedFile)
+	if cfg.FixedDuration > 0 {
+		if clipSeconds > float64(cfg.FixedDuration) {
+			clipSeconds = float64(cfg.FixedDuration)
+		}
+	} else if cfg.MaxClipSeconds > 0 && probeErr == nil && clipSeconds > float64(cfg.MaxClipSeconds) {
+		kept := "first"
+		if job.keepAll {
+			kept = "last"
+		}
+		job.log.Warning("Camera %s: %.0fs left after the trim, keeping the %s %ds (maxClipSeconds)",
+			cameraNum, clipSeconds, kept, cfg.MaxClipSeconds)
+		clipSeconds = float64(cfg.MaxClipSeconds)
+	}
+	if probeErr != nil {
+		clipSeconds = 0
+	}
+	if quality := cfg.QualityArgs(); quality != nil {
+		job.log.Info("Encoding Camera %s with the %s quality preset", cameraNum, cfg.QualityPreset)
+		args = reencode(args, quality)
+	} else if cfg.WebCompatible {
+		// Only pay for encoding when the browser could not play the recording
+		if compatible, err := isWebCompatible(sourceFile); err != nil {
+			job.log.Warning("Could not determine codecs of %s, copying streams: %v", sourceFile, err)
+		} else if !compatible {
+			job.log.Info("Camera %s is not recorded in H.264/AAC, encoding for web playback", cameraNum)
+			args = reencodeForWeb(args)
+		}
+	}
+	if cfg.OutputFps > 0 {
+		args = convertFps(args, cfg.OutputFps)
+	}
+	if cfg.LoudnessTarget != 0 {
+		if audio, err := hasAudio(sourceFile); err != nil {
+			job.log.Warning("Could not find the audio of %s, not normalizing loudness: %v", sourceFile, err)
+		} else if audio {
+			args = normalizeLoudness(args, cfg.LoudnessTarget)
+		}
+	}
+	cmd := createFfmpegCmd(withProgress(args))
+	job.log.Info("Executing trim command for Camera %s: %s", cameraNum, cmd.String())
+
+	if err := runWithProgress(cmd, clipSeconds, func(percent int) {
+		httpServer.SetCameraProgress(job.pipeline, cameraNum, httpServer.StageTrimming, percent)
+	}); err != nil {
+		if cfg.SinglePassTrim {
+			// Do not leave a truncated replay in the session directory
+			os.Remove(trimmedFile)
+		}
+		return files, fmt.Errorf("failed to trim video for Camera %s: %w", cameraNum, err)
+	}
+
+	if !cfg.SinglePassTrim {
+		// ffmpeg has exited, but do not copy the trimmed file before it is completely on disk
+		if err := waitForStableSize(trimmedFile); err != nil {
+			return files, fmt.Errorf("trimmed video for Camera %s is incomplete: %w", cameraNum, err)
+		}
+
+		// On the same volume the trimmed file is renamed into place, otherwise it is copied to the
+		// final destination (keeping the original) with progress, and checked to be intact
+		if err := os.Rename(trimmedFile, finalFileName); err == nil {
+			trimmedFile = finalFileName
+		} else if err := copyVerifiedWithProgress(trimmedFile, finalFileName, func(copied, total int64) {
+			httpServer.SetCameraProgress(job.pipeline, cameraNum, httpServer.StageCopying, int(copied*100/total))
+			httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Copying video for Camera %s: %d%% (%.0f of %.0f MB) - %s",
+				cameraNum, copied*100/total, float64(copied)/1e6, float64(total)/1e6, job.attemptInfo()))
+		}); err != nil {
+			return files, fmt.Errorf("failed to copy video to final location for Camera %s: %w", cameraNum, err)
+		}
+	}
+	files = append(files, finalFileName)
+
+	// Encode the additional outputs from the same trimmed file
+	for _, output := range derivatives(cfg, trimmedFile, fullSessionDir, baseFileName, cameraNum) {
+		httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("%s for Camera %s: %s", output.status, cameraNum, job.attemptInfo()))
+		httpServer.SetCameraProgress(job.pipeline, cameraNum, httpServer.StageEncoding, 0)
+
+		cmd := createFfmpegCmd(output.args)
+		job.log.Info("Executing %s command for Camera %s: %s", output.name, cameraNum, cmd.String())
+		if err := cmd.Run(); err != nil {
+			return files, fmt.Errorf("failed to %s for Camera %s: %w", output.action, cameraNum, err)
+		}
+		files = append(files, output.file)
+	}
+	return files, nil
+}
+
+// derivative is an additional video made from the trimmed replay of a camera
+type derivative struct {
+	name   string // for logs
+	status string // for the status while it is made
+	action string // for errors
+	file   string
+	args   []string
+}
+
+// derivatives returns the output profiles and the vertical crop configured for a camera, made
+// from the replay trimmedFile into dir
+func derivatives(cfg *config.Config, trimmedFile, dir, baseFileName, cameraNum string) []derivative {
+	var outputs []derivative
+	for _, profile := range cfg.Profiles {
+		file := filepath.Join(dir, fmt.Sprintf("%s_Camera%s_%s.%s", baseFileName, cameraNum, profile.Name, profile.Format))
+		outputs = append(outputs, derivative{
+			name:   profile.Name + " profile",
+			status: fmt.Sprintf("Encoding %s video", profile.Name),
+			action: fmt.Sprintf("encode %s video", profile.Name),
+			file:   file,
+			args:   buildProfileArgs(profile, trimmedFile, file),
+		})
+	}
+
+	// Crop a vertical video for social media if configured for this camera
+	if crop, ok := cfg.Vertical[cameraNum]; ok {
+		file := filepath.Join(dir, fmt.Sprintf("%s_Camera%s_vertical.mp4", baseFileName, cameraNum))
+		outputs = append(outputs, derivative{
+			name:   "vertical crop",
+			status: "Cropping vertical video",
+			action: "crop vertical video",
+			file:   file,
+			args:   buildVerticalArgs(crop, trimmedFile, file),
+		})
+	}
+	return outputs
+}
+
+// discard drops the recording of a no-lift without producing a replay, the sources are still
+// archived or kept if configured
+func (job *recordingJob) discard(sessionDir, baseFileName string) error {
+	job.disposeSources(sessionDir, baseFileName, nil)
+	state.ClearRecordingInProgress(job.startTime)
+	job.log.Info("No lift, replay discarded")
+	job.endProcessing(fmt.Sprintf("No lift, replay discarded: %s", job.attemptInfo()))
+	return nil
+}
+
+// trimmingArgs builds the ffmpeg arguments to trim a camera file, clipSeconds being what is left
+// after the trim when known. A recording stopped at the time limit keeps its last maxClipSeconds,
+// where the lift most likely is, rather than the first.
+func (job *recordingJob) trimmingArgs(cfg *config.Config, trimDuration int64, clipSeconds float64, known bool, sourceFile, trimmedFile string) []string {
+	switch {
+	case cfg.FixedDuration > 0:
+		return buildTailArgs(cfg.FixedDuration, sourceFile, trimmedFile)
+	case job.keepAll && cfg.MaxClipSeconds > 0 && (!known || clipSeconds > float64(cfg.MaxClipSeconds)):
+		return buildTailArgs(cfg.MaxClipSeconds, sourceFile, trimmedFile)
+	default:
+		return buildTrimmingArgs(trimDuration, sourceFile, trimmedFile)
+	}
+}
+
+// processInBackground moves the camera files out of the captures directory, so that the next
+// recording cannot pick them up, and processes them while the recorder handles the next attempt.
+// When a file cannot be moved, e.g. because OBS still holds it, those already moved are put back and
+// an error is returned for the job to be processed in place.
+func processInBackground(job *recordingJob) error {
+	workDir := filepath.Join(job.workDir, fmt.Sprintf("processing_%d", time.Now().UnixNano()))
+	if err := os.MkdirAll(workDir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create processing directory: %w", err)
+	}
+
+	var movedFiles []string
+	for _, sourceFile := range job.sourceFiles {
+		movedFile := filepath.Join(workDir, filepath.Base(sourceFile))
+		if err := os.Rename(sourceFile, movedFile); err != nil {
+			job.restoreMoved(movedFiles)
+			os.Remove(workDir)
+			return fmt.Errorf("failed to move %s for processing: %w", sourceFile, err)
+		}
+		if err := moveTiming(sourceFile, movedFile); err != nil {
+			job.log.Warning("Failed to move the timing file of %s: %v", sourceFile, err)
+		}
+		movedFiles = append(movedFiles, movedFile)
+	}
+	job.workDir = workDir
+	job.sourceFiles = movedFiles
+	httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Processing: %s", job.attemptInfo()))
+
+	pendingJobs.Add(1)
+	go func() {
+		defer pendingJobs.Done()
+		if err := job.process(); err != nil {
+			job.log.Error("Error during background processing: %v", err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+			return
+		}
+		if err := os.RemoveAll(workDir); err != nil {
+			job.log.Warning("Failed to remove processing directory %s: %v", workDir, err)
+		}
+	}()
+
+	job.log.Info("Processing in the background")
+	return nil
+}
+
+// restoreMoved puts the camera files moved for background processing back in the captures directory
+// with their timing files. A file that cannot be put back is processed where it is.
+func (job *recordingJob) restoreMoved(movedFiles []string) {
+	for i, movedFile := range movedFiles {
+		sourceFile := job.sourceFiles[i]
+		if err := os.Rename(movedFile, sourceFile); err != nil {
+			job.log.Warning("Failed to move %s back, processing it there: %v", movedFile, err)
+			job.sourceFiles[i] = movedFile
+			continue
+		}
+		if err := moveTiming(movedFile, sourceFile); err != nil {
+			job.log.Warning("Failed to move the timing file of %s back: %v", movedFile, err)
+		}
+	}
+}
+
+// WaitForPendingJobs waits for background processing to complete, returning false on timeout
+func WaitForPendingJobs(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		pendingJobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,98 @@
+//go:build integration
+
+package recording
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// TestProcessTrimsAndFilesRecording runs the trim and file steps of StopRecording against a
+// generated FLV. Run with: go test -tags integration ./internal/recording/
+func TestProcessTrimsAndFilesRecording(t *testing.T) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		t.Skip("ffmpeg not found in PATH")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not found in PATH")
+	}
+	FfmpegPath = ffmpeg
+
+	loadTestConfig(t, "")
+	baseDir := t.TempDir()
+	videoDir := config.GetVideoDir()
+
+	// Status updates go to the Fyne UI channel, which nothing reads in tests
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-httpServer.StatusChan:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Fixture: an 8 second recording as OBS would leave it in the captures directory
+	captureDir := filepath.Join(baseDir, "Captures")
+	if err := os.MkdirAll(captureDir, os.ModePerm); err != nil {
+		t.Fatalf("failed to create captures directory: %v", err)
+	}
+	sourceFile := filepath.Join(captureDir, "2024-01-01 10-00-00 Camera1.flv")
+	fixture := exec.Command(ffmpeg, "-y", "-f", "lavfi", "-i", "testsrc=duration=8:size=320x240:rate=25",
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-f", "flv", sourceFile)
+	if out, err := fixture.CombinedOutput(); err != nil {
+		t.Fatalf("failed to create fixture video: %v\n%s", err, out)
+	}
+
+	// Clock started at 1000 ms and stopped at 7000 ms: the first second is trimmed
+	state.CurrentAthlete = "Jane Doe"
+	state.CurrentLiftType = "SNATCH"
+	state.CurrentAttempt = 2
+	state.CurrentSession = "Session A"
+	state.LastStartTime = 1000
+	state.LastTimerStopTime = 7000
+
+	job := newRecordingJob(captureDir, []string{sourceFile}, 0, nil)
+	if err := job.process(); err != nil {
+		t.Fatalf("processing failed: %v", err)
+	}
+
+	sessionDir := filepath.Join(videoDir, "Session_A")
+	entries, err := os.ReadDir(sessionDir)
+	if err != nil {
+		t.Fatalf("session directory not created: %v", err)
+	}
+	pattern := regexp.MustCompile(`^.+_Jane_Doe_SNATCH_attempt2_Camera1\.mp4$`)
+	var finalFile string
+	for _, entry := range entries {
+		if pattern.MatchString(entry.Name()) {
+			finalFile = filepath.Join(sessionDir, entry.Name())
+		}
+	}
+	if finalFile == "" {
+		t.Fatalf("no replay matching %s in %s: %v", pattern, sessionDir, entries)
+	}
+
+	duration, err := probeDuration(finalFile)
+	if err != nil {
+		t.Fatalf("failed to probe %s: %v", finalFile, err)
+	}
+	if duration <= 0 {
+		t.Errorf("expected a non-zero duration for %s, got %.3f", finalFile, duration)
+	}
+
+	if _, err := os.Stat(sourceFile); !os.IsNotExist(err) {
+		t.Errorf("expected source %s to be removed", sourceFile)
+	}
+}
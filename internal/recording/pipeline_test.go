@@ -0,0 +1,277 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+// loadTestConfig loads a configuration made of the given toml lines, with videos in a temp directory
+func loadTestConfig(t *testing.T, lines string) {
+	t.Helper()
+	baseDir := t.TempDir()
+	if err := logging.Init(filepath.Join(baseDir, "logs")); err != nil {
+		t.Fatalf("failed to initialize logging: %v", err)
+	}
+	t.Cleanup(logging.Close)
+
+	configFile := filepath.Join(baseDir, "config.toml")
+	content := fmt.Sprintf("videoDir = %q\n%s", filepath.Join(baseDir, "videos"), lines)
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	config.InstallDir = baseDir
+	if _, err := config.LoadConfig(configFile); err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+}
+
+func TestTrimDurationWithoutTimerStop(t *testing.T) {
+	tests := []struct {
+		name             string
+		missingTimerStop string
+		job              recordingJob
+		want             int64
+	}{
+		{"timer stopped", "", recordingJob{startTime: 10000, timerStopTime: 70000, decisionTime: 73000}, 55000},
+		{"decision fallback", "", recordingJob{startTime: 10000, decisionTime: 73000}, 58000},
+		{"full recording", "full", recordingJob{startTime: 10000, decisionTime: 73000}, 0},
+		{"no decision time", "", recordingJob{startTime: 10000}, 0},
+		{"no start time", "", recordingJob{timerStopTime: 70000, decisionTime: 73000}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := ""
+			if tt.missingTimerStop != "" {
+				lines = fmt.Sprintf("missingTimerStop = %q\n", tt.missingTimerStop)
+			}
+			loadTestConfig(t, lines)
+			tt.job.log = logging.ForAttempt("Jane Doe", "SNATCH", 1, "")
+
+			if got := tt.job.trimDuration(); got != tt.want {
+				t.Errorf("trimDuration() = %d, want %d", got, tt.want)
+			}
+			if args := buildTrimmingArgs(tt.job.trimDuration(), "in.flv", "out.mp4"); tt.want == 0 && args[1] == "-ss" {
+				t.Errorf("expected the full recording to be kept, got %v", args)
+			}
+		})
+	}
+}
+
+func TestTimeLimitKeepsTheEnd(t *testing.T) {
+	loadTestConfig(t, "maxClipSeconds = 300\n")
+	cfg := config.GetCurrentConfig()
+	tests := []struct {
+		name        string
+		keepAll     bool
+		clipSeconds float64
+		known       bool
+		want        string // first option after -y
+	}{
+		{"trimmed attempt", false, 600, true, "-ss"},
+		{"time limit, long recording", true, 600, true, "-sseof"},
+		{"time limit, length unknown", true, 0, false, "-sseof"},
+		{"time limit, short recording", true, 200, true, "-ss"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := recordingJob{keepAll: tt.keepAll}
+			args := job.trimmingArgs(cfg, 1000, tt.clipSeconds, tt.known, "in.flv", "out.mp4")
+			if args[1] != tt.want {
+				t.Errorf("trimmingArgs() = %v, want %s first", args, tt.want)
+			}
+			if tt.want == "-sseof" && args[2] != "-300" {
+				t.Errorf("trimmingArgs() = %v, want the last 300s", args)
+			}
+		})
+	}
+}
+
+func TestTrimDurationOfStopsWithoutDecision(t *testing.T) {
+	// Each stop not given by a referee decision: the clock stop, when known, still places the lift,
+	// otherwise the recording is kept from the start of the attempt whatever missingTimerStop says
+	tests := []struct {
+		name string
+		job  recordingJob
+		want int64
+	}{
+		{"crash recovery with clock stop", recordingJob{startTime: 10000, timerStopTime: 70000, decisionTime: NoDecision}, 55000},
+		{"crash recovery without clock stop", recordingJob{startTime: 10000, decisionTime: NoDecision}, 0},
+		{"local trigger stop", recordingJob{startTime: 10000, decisionTime: NoDecision}, 0},
+		{"time limit", recordingJob{startTime: 10000, decisionTime: NoDecision}, 0},
+		{"time limit of a paused recording", recordingJob{startTime: 10000, decisionTime: NoDecision, pauses: []pauseInterval{{20000, 40000}}}, 0},
+		{"time limit after a clock stop", recordingJob{startTime: 10000, timerStopTime: 70000, decisionTime: NoDecision, keepAll: true}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, "missingTimerStop = \"decision\"\n")
+			tt.job.log = logging.ForAttempt("Jane Doe", "SNATCH", 1, "")
+			if got := tt.job.trimDuration(); got != tt.want {
+				t.Errorf("trimDuration() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterruptedRecordingKeepsTimerStop(t *testing.T) {
+	loadTestConfig(t, "")
+	state.SetStateFile(filepath.Join(t.TempDir(), "recording.json"))
+	t.Cleanup(func() { state.SetStateFile("") })
+
+	state.CurrentAthlete, state.CurrentLiftType, state.CurrentAttempt = "Jane_Doe", "SNATCH", 1
+	state.LastStartTime, state.LastTimerStopTime, state.StopRequestCount = 10000, 0, 0
+	state.SaveRecordingInProgress()
+	state.UpdateStateFromStopMessage("")
+	stopTime := state.LastTimerStopTime
+
+	// The application is restarted: the attempt comes back from the state file only
+	state.LastStartTime, state.LastTimerStopTime = 0, 0
+	snapshot := state.LoadInterruptedRecording()
+	if snapshot == nil {
+		t.Fatal("recording in progress was not persisted")
+	}
+	if snapshot.TimerStopTime != stopTime {
+		t.Fatalf("persisted timer stop = %d, want %d", snapshot.TimerStopTime, stopTime)
+	}
+	snapshot.Restore()
+	job := newRecordingJob(t.TempDir(), nil, NoDecision, nil)
+	if got, want := job.trimDuration(), stopTime-10000-5000; got != want {
+		t.Errorf("trimDuration() = %d, want %d", got, want)
+	}
+}
+
+func TestAlignedTrim(t *testing.T) {
+	const start = int64(1700000000000) // clock start of the attempt
+	tests := []struct {
+		name      string
+		clipStart int64  // replay buffer clip, 0 for a recording
+		sidecar   string // content of the timing file, none if empty
+		offsetMs  int64  // first frame of the camera after the origin
+		trim      int64
+		want      int64
+	}{
+		{"no timing file", 0, "", 0, 55000, 55000},
+		{"camera started late", 0, "time", 2000, 55000, 53000},
+		{"camera started early", 0, "time", -1500, 55000, 56500},
+		{"offset too large", 0, "time", 10001, 55000, 55000},
+		{"offset too large before", 0, "time", -10001, 55000, 55000},
+		{"clamped at the start", 0, "time", 8000, 5000, 0},
+		{"invalid timing file", 0, "{", 0, 55000, 55000},
+		{"timing file without start", 0, "{}", 0, 55000, 55000},
+		{"replay buffer clip", start - 30000, "time", 1000, 85000, 84000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, "")
+			job := recordingJob{startTime: start, clipStart: tt.clipStart, log: logging.ForAttempt("Jane Doe", "SNATCH", 1, "")}
+			sourceFile := filepath.Join(t.TempDir(), "Camera2.flv")
+			content := tt.sidecar
+			if content == "time" {
+				first := time.UnixMilli(job.origin() + tt.offsetMs)
+				content = fmt.Sprintf(`{"start": %q}`, first.Format(time.RFC3339Nano))
+			}
+			if content != "" {
+				if err := os.WriteFile(timingFile(sourceFile), []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := job.alignedTrim(sourceFile, "2", tt.trim, job.origin()); got != tt.want {
+				t.Errorf("alignedTrim() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoveTimingFollowsCameraFile(t *testing.T) {
+	dir := t.TempDir()
+	clip := filepath.Join(dir, "Replay 2024-01-01 10-00-00.mkv")
+	renamed := filepath.Join(dir, "Replay_2024-01-01_10-00-00.000_Camera1.mkv")
+	if err := os.WriteFile(timingFile(clip), []byte(`{"start": "2024-01-01T10:00:00Z"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := moveTiming(clip, renamed); err != nil {
+		t.Fatalf("moveTiming() failed: %v", err)
+	}
+	if _, found, err := readTiming(renamed); !found || err != nil {
+		t.Errorf("timing file of %s not found after the move (err %v)", renamed, err)
+	}
+	if err := moveTiming(filepath.Join(dir, "Camera3.flv"), filepath.Join(dir, "moved", "Camera3.flv")); err != nil {
+		t.Errorf("moveTiming() without a timing file failed: %v", err)
+	}
+}
+
+func TestTrimDurationWithPauses(t *testing.T) {
+	// The clock starts at 10s and stops at 70s, the decision comes at 73s
+	tests := []struct {
+		name         string
+		pauses       []pauseInterval
+		want         int64 // trimmed relative to the clock stop
+		wantDecision int64 // trimmed relative to the decision, without clock stop
+	}{
+		{"no pause", nil, 55000, 58000},
+		{"pause before the stop", []pauseInterval{{20000, 30000}}, 45000, 48000},
+		{"two pauses before the stop", []pauseInterval{{20000, 30000}, {40000, 45000}}, 40000, 43000},
+		{"pause after the stop", []pauseInterval{{71000, 90000}}, 55000, 56000},
+		{"pause across the stop", []pauseInterval{{65000, 90000}}, 50000, 50000},
+		{"pauses before and after the stop", []pauseInterval{{20000, 30000}, {74000, 90000}}, 45000, 48000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadTestConfig(t, "")
+			job := recordingJob{startTime: 10000, timerStopTime: 70000, decisionTime: 73000, pauses: tt.pauses,
+				log: logging.ForAttempt("Jane Doe", "SNATCH", 1, "")}
+			if got := job.trimDuration(); got != tt.want {
+				t.Errorf("trimDuration() = %d, want %d", got, tt.want)
+			}
+			job.timerStopTime = 0
+			if got := job.trimDuration(); got != tt.wantDecision {
+				t.Errorf("trimDuration() without clock stop = %d, want %d", got, tt.wantDecision)
+			}
+		})
+	}
+}
+
+func TestBookmarkChaptersFollowTheTrim(t *testing.T) {
+	// The clock starts at 10s and stops at 70s, the recording is paused from 20s to 30s. A bookmark
+	// at the clock stop must land 5s into the replay, where the trim puts the stop.
+	loadTestConfig(t, "")
+	job := recordingJob{startTime: 10000, timerStopTime: 70000, pauses: []pauseInterval{{20000, 30000}},
+		bookmarks: []int64{5000, 60000}, log: logging.ForAttempt("Jane Doe", "SNATCH", 1, "")}
+	chapters := bookmarkChapters(job.clipBookmarks(), job.trimDuration())
+	if len(chapters) != 1 || chapters[0].Time != 5 {
+		t.Errorf("chapters = %+v, want one at 5s", chapters)
+	}
+}
+
+func TestManifestKeepsFilesForTheArchive(t *testing.T) {
+	archiveDir := t.TempDir()
+	loadTestConfig(t, fmt.Sprintf("archiveDir = %q\n", archiveDir))
+	sessionDir := filepath.Join(config.GetVideoDir(), "Session_A")
+	if err := os.MkdirAll(sessionDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	video := filepath.Join(sessionDir, "Jane_Doe_SNATCH_attempt1_Camera1.mp4")
+	if err := os.WriteFile(video, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	finalFiles := []string{video}
+	manifestFile := filepath.Join(sessionDir, "Jane_Doe_SNATCH_attempt1.json")
+	if err := writeManifest(manifestFile, types.ReplayManifest{Files: finalFiles}); err != nil {
+		t.Fatalf("writeManifest() failed: %v", err)
+	}
+	log := logging.ForAttempt("Jane Doe", "SNATCH", 1, "")
+	if failed := copyToArchive(log, config.GetCurrentConfig().ArchiveDir, append(finalFiles, manifestFile)); len(failed) > 0 {
+		t.Fatalf("copyToArchive() failed for %v", failed)
+	}
+	if _, err := os.Stat(filepath.Join(archiveDir, "Session_A", filepath.Base(video))); err != nil {
+		t.Errorf("video not archived: %v", err)
+	}
+}
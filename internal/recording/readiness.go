@@ -0,0 +1,86 @@
+package recording
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+)
+
+// The operator sees a single Ready once every recording being processed is filed, and highlights
+// exports and backfills are done. While other work is still running or queued, finished work only
+// updates the processing status.
+
+var (
+	readyMu sync.Mutex
+	// activeJobs counts the recordings, exports and backfills being processed or waiting for a slot
+	activeJobs int
+	// readyTimer sends the Ready status after readyDebounceMs
+	readyTimer *time.Timer
+)
+
+// beginProcessing counts a recording being processed and holds back a pending Ready
+func (job *recordingJob) beginProcessing() {
+	beginWork()
+}
+
+// endProcessing stops counting the recording, and reports Ready with readyText when it was the
+// last one. An empty readyText is for a failed recording whose error was reported. Only the
+// first call for a job counts.
+func (job *recordingJob) endProcessing(readyText string) {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	if job.processed {
+		return
+	}
+	job.processed = true
+	endWorkLocked(job.attemptInfo()+" filed", readyText)
+}
+
+// beginWork counts a recording, highlights export or backfill being processed and holds back a
+// pending Ready
+func beginWork() {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	activeJobs++
+	if readyTimer != nil {
+		readyTimer.Stop()
+		readyTimer = nil
+	}
+}
+
+// endWork stops counting work that is not a recording, done describes it once finished. See
+// endProcessing for readyText.
+func endWork(done, readyText string) {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	endWorkLocked(done, readyText)
+}
+
+// endWorkLocked is endWork with readyMu held
+func endWorkLocked(done, readyText string) {
+	activeJobs--
+	if readyText == "" {
+		return
+	}
+	if activeJobs > 0 {
+		httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Processing: %s, %d job(s) remaining",
+			done, activeJobs))
+		return
+	}
+
+	delay := time.Duration(config.GetCurrentConfig().ReadyDebounceMs) * time.Millisecond
+	if delay == 0 {
+		httpServer.SendStatus(httpServer.Ready, readyText)
+		return
+	}
+	readyTimer = time.AfterFunc(delay, func() {
+		readyMu.Lock()
+		defer readyMu.Unlock()
+		if activeJobs == 0 {
+			httpServer.SendStatus(httpServer.Ready, readyText)
+		}
+	})
+}
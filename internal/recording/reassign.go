@@ -0,0 +1,227 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/types"
+)
+
+// unsortedDir is where replays recorded without a session are filed
+const unsortedDir = "unsorted"
+
+// replayFileRegexp splits the files of a replay into the base name and the camera part
+var replayFileRegexp = regexp.MustCompile(`^(.+_attempt\d+)(_Camera.+\.mp4|\.json)$`)
+
+// splitBase separates the base name of a replay before its lift type, to insert a suffix
+var splitBase = regexp.MustCompile(`^(.+)(_[^_]+_attempt\d+)$`)
+
+// unsortedReplay is a replay in the unsorted directory
+type unsortedReplay struct {
+	base    string
+	created time.Time
+	files   []string
+}
+
+// ReassignReplays moves replays from the unsorted directory into the directory of a session, for
+// replays recorded before owlcms announced the session. Replays are selected by base name, or by
+// the time they were recorded when no names are given. It returns the new base names.
+func ReassignReplays(clips []string, from, to time.Time, session string) ([]string, error) {
+	sessionName := strings.ReplaceAll(strings.TrimSpace(session), " ", "_")
+	if sessionName == "" || sessionName == unsortedDir || sessionName == "." || sessionName == ".." ||
+		strings.ContainsAny(sessionName, `/\`) {
+		return nil, fmt.Errorf("invalid session name %q", session)
+	}
+
+	// With datePrefix each day has its own unsorted folder, replays stay in their day
+	dirs, err := config.SessionDirs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read videos directory: %w", err)
+	}
+	var moved []string
+	for _, dir := range dirs {
+		if path.Base(dir) != unsortedDir {
+			continue
+		}
+		sourceDir := filepath.Join(config.GetVideoDir(), filepath.FromSlash(dir))
+		replays, err := listUnsorted(sourceDir)
+		if err != nil {
+			return moved, err
+		}
+		selected := selectReplays(replays, clips, from, to)
+		if len(selected) == 0 {
+			continue
+		}
+
+		// The same folder as replays recorded during the session, shortened alike
+		dayDir := filepath.Dir(sourceDir)
+		sessionName, _ := config.FitSessionName(dayDir, session, config.PathLimit())
+		targetDir := filepath.Join(dayDir, sessionName)
+		if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+			return moved, fmt.Errorf("failed to create session directory: %w", err)
+		}
+		for _, replay := range selected {
+			targetDir := targetDir
+			if liftType := replayLiftType(replay.base); liftType != "" && config.GetCurrentConfig().LiftTypeFolders {
+				targetDir = filepath.Join(targetDir, config.LiftTypeDir(liftType))
+				if err := os.MkdirAll(targetDir, os.ModePerm); err != nil {
+					return moved, fmt.Errorf("failed to create lift type directory: %w", err)
+				}
+			}
+			base, err := moveReplay(replay, sourceDir, targetDir, session)
+			if err != nil {
+				return moved, fmt.Errorf("failed to move %s: %w", replay.base, err)
+			}
+			logging.InfoLogger.Printf("Moved replay %s from %s to %s", replay.base, sourceDir, filepath.Join(targetDir, base))
+			moved = append(moved, base)
+		}
+		updateSessionIndex(targetDir)
+	}
+	return moved, nil
+}
+
+// replayLiftType returns the lift type in the base name of a replay, empty if none is recognized
+func replayLiftType(base string) string {
+	for _, liftType := range config.LiftTypes {
+		if strings.Contains(base, "_"+liftType+"_attempt") {
+			return liftType
+		}
+	}
+	return ""
+}
+
+// listUnsorted groups the files of the unsorted directory by replay
+func listUnsorted(dir string) (map[string]*unsortedReplay, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	// The timestamp layout is configurable and may itself contain underscores
+	timestampName := config.TimestampNameRegexp()
+
+	replays := make(map[string]*unsortedReplay)
+	for _, entry := range entries {
+		matches := replayFileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		replay, ok := replays[matches[1]]
+		if !ok {
+			replay = &unsortedReplay{base: matches[1]}
+			created := false
+			if parts := timestampName.FindStringSubmatch(matches[1]); parts != nil {
+				if t, err := config.ParseTimestamp(parts[1]); err == nil {
+					replay.created, created = t, true
+				}
+			}
+			if info, err := entry.Info(); !created && err == nil {
+				replay.created = info.ModTime()
+			}
+			replays[matches[1]] = replay
+		}
+		replay.files = append(replay.files, entry.Name())
+	}
+	return replays, nil
+}
+
+// selectReplays returns the named replays, or those recorded between from and to (either may be zero)
+func selectReplays(replays map[string]*unsortedReplay, clips []string, from, to time.Time) []*unsortedReplay {
+	var selected []*unsortedReplay
+	if len(clips) > 0 {
+		for _, clip := range clips {
+			// Accept a file name as well as a base name
+			if matches := replayFileRegexp.FindStringSubmatch(clip); matches != nil {
+				clip = matches[1]
+			}
+			if replay, ok := replays[clip]; ok {
+				selected = append(selected, replay)
+			}
+		}
+	} else {
+		for _, replay := range replays {
+			if (from.IsZero() || !replay.created.Before(from)) && (to.IsZero() || !replay.created.After(to)) {
+				selected = append(selected, replay)
+			}
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool { return selected[i].base < selected[j].base })
+	return selected
+}
+
+// moveReplay moves the files of a replay to targetDir, renaming them if another replay already
+// has the same name, and records the session in its manifest. It returns the new base name.
+func moveReplay(replay *unsortedReplay, sourceDir, targetDir, session string) (string, error) {
+	base := freeBaseName(replay.base, targetDir)
+	for _, name := range replay.files {
+		if strings.HasSuffix(name, ".json") {
+			continue
+		}
+		newName := base + strings.TrimPrefix(name, replay.base)
+		if err := os.Rename(filepath.Join(sourceDir, name), filepath.Join(targetDir, newName)); err != nil {
+			return "", err
+		}
+	}
+
+	manifestFile := filepath.Join(sourceDir, replay.base+".json")
+	data, err := os.ReadFile(manifestFile)
+	if os.IsNotExist(err) {
+		return base, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var manifest types.ReplayManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", fmt.Errorf("invalid manifest %s: %w", manifestFile, err)
+	}
+	manifest.Session = session
+	for i, name := range manifest.Files {
+		manifest.Files[i] = base + strings.TrimPrefix(name, replay.base)
+	}
+	if err := writeManifest(filepath.Join(targetDir, base+".json"), manifest); err != nil {
+		return "", err
+	}
+	return base, os.Remove(manifestFile)
+}
+
+// freeBaseName returns base, or base with a numbered suffix after the athlete name when a replay
+// with that name is already in dir
+func freeBaseName(base, dir string) string {
+	reservedMu.Lock()
+	defer reservedMu.Unlock()
+	return freeName(base, dir)
+}
+
+// freeName is freeBaseName for callers holding reservedMu, names being filed are also taken
+func freeName(base, dir string) string {
+	candidate := base
+	for n := 2; ; n++ {
+		existing, _ := filepath.Glob(filepath.Join(dir, globEscape(candidate)+"[._]*"))
+		if len(existing) == 0 && !reservedNames[filepath.Join(dir, candidate)] {
+			return candidate
+		}
+		if parts := splitBase.FindStringSubmatch(base); parts != nil {
+			candidate = fmt.Sprintf("%s-%d%s", parts[1], n, parts[2])
+		} else {
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+	}
+}
+
+// globEscape escapes the characters filepath.Match treats specially
+func globEscape(s string) string {
+	return strings.NewReplacer(`*`, `[*]`, `?`, `[?]`, `[`, `[[]`).Replace(s)
+}
@@ -1,10 +1,12 @@
 package recording
 
 import (
+	"bufio"
 	"fmt"
-	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,37 +22,208 @@ var (
 	obsClient        *OBSWebSocketClient
 )
 
-// InitializeRecorder sets up the OBS client connection
-func InitializeRecorder() error {
+// InitializeRecorder sets up the OBS client connection and runs onConnect once it is up. When OBS
+// cannot be reached yet the error is returned and the connection is retried in the background,
+// onFailure is called with the first error and with every retry that fails.
+func InitializeRecorder(onConnect func(), onFailure func(error)) error {
 	obsClient = NewOBSWebSocketClient()
-	if err := obsClient.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to OBS WebSocket: %v", err)
+	err := obsClient.Connect()
+	httpServer.ReportHealth("obsConnection", err)
+	if err == nil {
+		onConnect()
+		return nil
 	}
-	return nil
+	onFailure(err)
+
+	// OBS may simply not be started yet, keep trying so that recording begins once it is
+	go func() {
+		obsClient.keepConnected(onFailure)
+		if obsClient.IsConnected() {
+			logging.InfoLogger.Println("OBS WebSocket is now available")
+			onConnect()
+		}
+	}()
+	return fmt.Errorf("failed to connect to OBS WebSocket: %w", err)
+}
+
+// OBSStatus describes the connection to OBS for the health endpoint
+func OBSStatus() httpServer.OBSStatus {
+	if obsClient == nil {
+		return httpServer.OBSStatus{LastError: "not connected yet"}
+	}
+	return obsClient.Status()
 }
 
-// buildTrimmingArgs builds the ffmpeg arguments for trimming
+// GetCaptureDir returns the directory where OBS writes the camera files
+func GetCaptureDir() string {
+	return filepath.Join(os.Getenv("USERPROFILE"), "Videos", "Captures")
+}
+
+// buildTrimmingArgs builds the ffmpeg arguments for trimming, keeping at most maxClipSeconds
 func buildTrimmingArgs(trimDuration int64, currentFileName, finalFileName string) []string {
-	args := []string{"-y"}
+	var seek, limit []string
 	if trimDuration > 0 {
-		args = append(args, "-ss", fmt.Sprintf("%d", trimDuration/1000))
+		seek = []string{"-ss", fmt.Sprintf("%.3f", float64(trimDuration)/1000)}
+	}
+	if cfg := config.GetCurrentConfig(); cfg != nil && cfg.MaxClipSeconds > 0 {
+		limit = []string{"-t", fmt.Sprintf("%d", cfg.MaxClipSeconds)}
+	}
+	return withFfmpegParams(seek, limit, currentFileName, finalFileName)
+}
+
+// buildTailArgs builds the ffmpeg arguments keeping only the last seconds of the recording
+func buildTailArgs(seconds int, currentFileName, finalFileName string) []string {
+	return withFfmpegParams([]string{"-sseof", fmt.Sprintf("-%d", seconds)}, nil, currentFileName, finalFileName)
+}
+
+// withFfmpegParams builds a stream copy command with the configured global, input and output
+// parameters around the seek options and the output length limit
+func withFfmpegParams(seek, limit []string, currentFileName, finalFileName string) []string {
+	var global, input, output []string
+	if cfg := config.GetCurrentConfig(); cfg != nil {
+		global, input, output = cfg.FfmpegArgs()
+	}
+	args := append([]string{"-y"}, global...)
+	args = append(args, seek...)
+	args = append(args, input...)
+	args = append(args, "-i", currentFileName, "-c", "copy")
+	args = append(args, limit...)
+	args = append(args, output...)
+	return append(args, finalFileName)
+}
+
+// waitForRecordingActive polls OBS until its recording output is active or the configured timeout elapses
+func waitForRecordingActive() error {
+	timeout := time.Duration(config.GetCurrentConfig().RecordStartTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		return nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		// A RecordStateChanged event may already have confirmed it
+		if obsClient.IsRecording() {
+			return nil
+		}
+		active, err := obsClient.GetRecordStatus()
+		if err != nil {
+			return fmt.Errorf("failed to get OBS recording status: %w", err)
+		}
+		if active {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("recording not active after %v, check the OBS hotkey bindings", timeout)
+		}
+		time.Sleep(200 * time.Millisecond)
 	}
-	args = append(args,
-		"-i", currentFileName,
-		"-c", "copy",
-	)
-	args = append(args, finalFileName)
+}
+
+// recordStopTimeout limits how long OBS may take to close its recording after the stop hotkey
+const recordStopTimeout = 10 * time.Second
+
+// waitForRecordingStopped waits until OBS reports that its recording output is stopped, from the
+// RecordStateChanged event or by asking OBS when the event does not come
+func waitForRecordingStopped() error {
+	deadline := time.Now().Add(recordStopTimeout)
+	for {
+		if obsClient.RecordState() == obsOutputStopped {
+			return nil
+		}
+		active, err := obsClient.GetRecordStatus()
+		if err != nil {
+			return fmt.Errorf("failed to get OBS recording status: %w", err)
+		}
+		if !active {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("recording still active %v after the stop hotkey", recordStopTimeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// buildProfileArgs builds the ffmpeg arguments to encode a trimmed video according to an output profile
+func buildProfileArgs(profile config.OutputProfile, trimmedFileName, outputFileName string) []string {
+	args := []string{"-y", "-i", trimmedFileName}
+	if profile.Scale != "" {
+		args = append(args, "-vf", "scale="+profile.Scale)
+	}
+	switch {
+	case profile.Codec != "":
+		args = append(args, "-c:v", profile.Codec, "-c:a", "copy")
+	case profile.Scale == "":
+		args = append(args, "-c", "copy")
+	}
+	args = append(args, strings.Fields(profile.Params)...)
+	args = append(args, outputFileName)
 	return args
 }
 
+// buildVerticalArgs builds the ffmpeg arguments to crop a trimmed video into a vertical video
+func buildVerticalArgs(crop config.VerticalCrop, trimmedFileName, outputFileName string) []string {
+	// Crop the largest region with the output aspect ratio that fits the zoomed picture height. A source
+	// too narrow for that ratio is scaled to cover the output and cropped again, never stretched.
+	ratio := float64(crop.OutputWidth) / float64(crop.OutputHeight)
+	filter := fmt.Sprintf("crop=w='min(iw,ih/%g*%g)':h='ih/%g':x='max(0,min(iw-ow,iw*(0.5+%g)-ow/2))':y='max(0,min(ih-oh,ih*(0.5+%g)-oh/2))',"+
+		"scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d,setsar=1",
+		crop.Zoom, ratio, crop.Zoom, crop.OffsetX, crop.OffsetY, crop.OutputWidth, crop.OutputHeight, crop.OutputWidth, crop.OutputHeight)
+	return []string{"-y",
+		"-i", trimmedFileName,
+		"-vf", filter,
+		"-c:v", "libx264",
+		"-c:a", "copy",
+		outputFileName,
+	}
+}
+
 // StartRecording starts recording videos using OBS
 func StartRecording(fullName, liftTypeKey string, attemptNumber int) error {
-	// reset the Replay Source plugin and start recording
-	if err := obsClient.TriggerHotkey("OBS_KEY_F6"); err != nil {
-		return fmt.Errorf("failed to send F6 hotkey to OBS: %w", err)
+	cfg := config.GetCurrentConfig()
+	log := logging.ForAttempt(fullName, liftTypeKey, attemptNumber, state.CurrentSession)
+	if resumeRecording(log) {
+		return nil
+	}
+	if continueRecording() {
+		log.Info("Start within %d ms of a stop, continuing the same recording", cfg.CoalesceWindowMs)
+		state.SaveRecordingInProgress()
+		return nil
+	}
+	if !acceptStart(log) {
+		return nil
 	}
-	if err := obsClient.TriggerHotkey("OBS_KEY_F7"); err != nil {
-		return fmt.Errorf("failed to send F7 hotkey to OBS: %w", err)
+	// A slow command must not delay the start of the recording, the lift would be missed
+	go runHook("pre-record", cfg.PreRecordCommand, log, fullName, liftTypeKey, attemptNumber, state.CurrentSession,
+		attemptFields(state.CurrentFields, state.CurrentWeight, state.DecisionUnknown))
+
+	setFallbackRecording(false)
+	if cfg.ReplayBuffer {
+		// The buffer keeps recording, it is saved at the decision. Without it the attempt would be
+		// lost, it is recorded the usual way instead.
+		if err := startReplayBuffer(); err != nil {
+			log.Warning("%v, recording the attempt instead", err)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Warning: replay buffer unavailable, recording the attempt instead - %v", err))
+			setFallbackRecording(true)
+		}
+	}
+	if !usingReplayBuffer() {
+		// reset the Replay Source plugin and start recording, by default F6 then F7
+		for i, key := range cfg.StartHotkeys {
+			if i > 0 && cfg.StartHotkeyDelayMs > 0 {
+				// Give OBS time to act on the previous hotkey, the reset can be slow on weaker machines
+				time.Sleep(time.Duration(cfg.StartHotkeyDelayMs) * time.Millisecond)
+			}
+			if err := obsClient.TriggerHotkey(key); err != nil {
+				return fmt.Errorf("failed to send %s hotkey to OBS: %w", key, err)
+			}
+		}
+
+		// Only report that we are recording once OBS confirms it
+		if err := waitForRecordingActive(); err != nil {
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: OBS did not start recording - %v", err))
+			return err
+		}
 	}
 
 	httpServer.SendStatus(httpServer.Recording, fmt.Sprintf("Recording: %s - %s attempt %d",
@@ -58,15 +231,67 @@ func StartRecording(fullName, liftTypeKey string, attemptNumber int) error {
 		liftTypeKey,
 		attemptNumber))
 
-	logging.InfoLogger.Printf("Started recording")
+	// Remember the attempt so it can be finalized if we crash before it is stopped
+	state.ExpectedCameras = expectedCameras()
+	state.SaveRecordingInProgress()
+	// Bookmarks are measured from the start of the attempt, like the trim
+	state.BeginBookmarks(state.LastStartTime)
+	trackPauses()
+	setCurrentRecording()
+	if !usingReplayBuffer() {
+		startMaxDuration(log)
+	}
+
+	log.Info("Started recording")
 	return nil
 }
 
-// StopRecording stops the current recordings and trims the videos
+// expectedCameras returns the camera numbers that should be recorded, from expectedCameras or cameraSources
+func expectedCameras() []string {
+	cfg := config.GetCurrentConfig()
+	if len(cfg.ExpectedCameras) > 0 {
+		return append([]string(nil), cfg.ExpectedCameras...)
+	}
+	var cameras []string
+	for camera := range cfg.CameraSources {
+		cameras = append(cameras, camera)
+	}
+	sort.Strings(cameras)
+	return cameras
+}
+
+// NoDecision is given to StopRecording for a stop that does not come from a referee decision. The
+// recording is then kept from the start of the attempt unless the clock stop is known.
+const NoDecision int64 = 0
+
+// StopRecording stops the current recordings and trims the videos around the clock stop, or the
+// decision at decisionTime when the clock stop was not received
 func StopRecording(decisionTime int64) error {
-	captureDir := filepath.Join(os.Getenv("USERPROFILE"), "Videos", "Captures")
+	return stopRecording(decisionTime, false)
+}
+
+// stopRecording is StopRecording, keeping the whole recording when keepAll is set
+func stopRecording(decisionTime int64, keepAll bool) error {
+	if !acceptStop() {
+		return nil
+	}
+	if waitForContinuation() {
+		return nil
+	}
+	cancelMaxDuration()
+	clearCurrentRecording()
+	if usingReplayBuffer() {
+		return stopReplayBuffer(decisionTime, keepAll)
+	}
+	return stopOBSRecording(decisionTime, keepAll)
+}
+
+// stopOBSRecording stops the OBS recording and trims the camera files
+func stopOBSRecording(decisionTime int64, keepAll bool) error {
+	captureDir := GetCaptureDir()
 
-	// Stop recording and free files
+	// Stop recording and free files, OBS also stops a paused recording
+	pauses := endPauses()
 	if err := obsClient.TriggerHotkey("OBS_KEY_F8"); err != nil {
 		return fmt.Errorf("failed to send F8 hotkey to OBS: %w", err)
 	}
@@ -74,127 +299,342 @@ func StopRecording(decisionTime int64) error {
 		return fmt.Errorf("failed to send F6 hotkey to OBS: %w", err)
 	}
 
-	// Give OBS a moment to finish writing files
-	time.Sleep(3 * time.Second)
-
-	// Find *Camera*.flv files in captures directory
-	files, err := os.ReadDir(captureDir)
-	if err != nil {
-		return fmt.Errorf("failed to read captures directory: %w", err)
+	// OBS confirms with a RecordStateChanged event once the recording file is closed
+	if err := waitForRecordingStopped(); err != nil {
+		logging.WarningLogger.Printf("Could not confirm that OBS stopped recording: %v", err)
 	}
 
-	var sourceFiles []string
-	for _, file := range files {
-		name := file.Name()
-		if strings.HasSuffix(name, ".flv") && strings.Contains(name, "Camera") {
-			sourceFiles = append(sourceFiles, filepath.Join(captureDir, name))
-		}
+	// Find the camera files (by default *Camera*.<recordingFormat>) in captures directory
+	pipeline := httpServer.BeginPipeline(describeAttempt(state.CurrentAthlete, state.CurrentLiftType, state.CurrentAttempt))
+	sourceFiles, err := waitForCameraFiles(captureDir, state.ExpectedCameras)
+	if err != nil {
+		httpServer.EndPipeline(pipeline, err)
+		return err
 	}
 
 	if len(sourceFiles) == 0 {
-		return fmt.Errorf("no camera files found in captures directory %s", captureDir)
+		// Nothing left to finalize for this attempt
+		state.ClearRecordingInProgress(state.LastStartTime)
+		err := fmt.Errorf("no camera files found in captures directory %s", captureDir)
+		httpServer.EndPipeline(pipeline, err)
+		return err
 	}
 
-	// First pass: trim each camera file to MP4
-	var trimmedFiles []string
+	// Source Record outputs are closed separately from the main recording
 	for _, sourceFile := range sourceFiles {
-		if idx := strings.LastIndex(sourceFile, "Camera"); idx != -1 {
-			cameraNum := strings.TrimSuffix(sourceFile[idx+6:], ".flv") // +6 to skip "Camera"
-			trimmedFile := filepath.Join(captureDir, fmt.Sprintf("Camera%s.mp4", cameraNum))
-			trimmedFiles = append(trimmedFiles, trimmedFile)
-
-			// Process video trimming
-			attemptInfo := fmt.Sprintf("%s - %s attempt %d",
-				strings.ReplaceAll(state.CurrentAthlete, "_", " "),
-				state.CurrentLiftType,
-				state.CurrentAttempt)
+		if err := waitForStableSize(sourceFile); err != nil {
+			logging.WarningLogger.Printf("Camera file may be incomplete: %v", err)
+		}
+	}
 
-			httpServer.SendStatus(httpServer.Trimming, fmt.Sprintf("Trimming video for Camera %s: %s", cameraNum, attemptInfo))
+	job := newRecordingJob(captureDir, sourceFiles, decisionTime, state.EndBookmarks())
+	job.pauses = pauses
+	job.keepAll = keepAll
+	job.pipeline = pipeline
+	job.log.Info("Stopped recording, %d camera file(s)", len(sourceFiles))
+	return job.run()
+}
 
-			startTime := state.LastStartTime
-			trimDuration := state.LastTimerStopTime - startTime - 5000
+// waitForCameraFiles scans the captures directory until a file is found for each expected camera,
+// or for at least one camera when none are expected, or cameraFileTimeoutMs elapses
+func waitForCameraFiles(captureDir string, expected []string) ([]string, error) {
+	timeout := time.Duration(config.GetCurrentConfig().CameraFileTimeoutMs) * time.Millisecond
+	deadline := time.Now().Add(timeout)
+	for {
+		sourceFiles, found, err := scanCameraFiles(captureDir)
+		if err != nil {
+			return nil, err
+		}
+		missing := missingFrom(expected, found)
+		if len(missing) == 0 && len(sourceFiles) > 0 {
+			return sourceFiles, nil
+		}
+		if time.Now().After(deadline) {
+			if len(missing) > 0 {
+				logging.WarningLogger.Printf("No file for camera(s) %v after %v, found %d camera file(s)", missing, timeout, len(sourceFiles))
+			}
+			return sourceFiles, nil
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+}
 
-			args := buildTrimmingArgs(trimDuration, sourceFile, trimmedFile)
-			cmd := createFfmpegCmd(args)
-			logging.InfoLogger.Printf("Executing trim command for Camera %s: %s", cameraNum, cmd.String())
+// scanCameraFiles returns the camera files of the captures directory and their camera identifiers
+func scanCameraFiles(captureDir string) (files []string, cameras []string, err error) {
+	entries, err := os.ReadDir(captureDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read captures directory: %w", err)
+	}
+	for _, entry := range entries {
+		if camera, ok := cameraID(entry.Name()); ok && !entry.IsDir() {
+			files = append(files, filepath.Join(captureDir, entry.Name()))
+			cameras = append(cameras, camera)
+		}
+	}
+	return files, cameras, nil
+}
 
-			if err := cmd.Run(); err != nil {
-				return fmt.Errorf("failed to trim video for Camera %s: %w", cameraNum, err)
-			}
+// ForceStopRecordings stops the OBS recording without trimming
+func ForceStopRecordings() error {
+	if config.NoVideo {
+		for i, fileName := range currentFileNames {
+			logging.InfoLogger.Printf("Simulating forced stop recording video for Camera %d: %s", i+1, fileName)
 		}
+		return nil
+	}
+	if obsClient == nil {
+		return fmt.Errorf("not connected to OBS")
 	}
+	clearCurrentRecording()
+	if usingReplayBuffer() {
+		// Nothing to stop, the replay buffer keeps running
+		state.EndBookmarks()
+		return nil
+	}
+	endPauses()
+	cancelMaxDuration()
+	if err := obsClient.TriggerHotkey("OBS_KEY_F8"); err != nil {
+		logging.ErrorLogger.Printf("Failed to send F8 hotkey to OBS: %v", err)
+		return fmt.Errorf("failed to send F8 hotkey to OBS: %w", err)
+	}
+	state.EndBookmarks()
+	return nil
+}
 
-	// Create session directory for final copies
-	sessionDir := state.CurrentSession
-	if sessionDir == "" {
-		sessionDir = "unsorted"
+// FfmpegVersion returns the ffmpeg executable that will be used and the first line of its version output
+func FfmpegVersion() (string, string, error) {
+	cmd := createFfmpegCmd([]string{"-version"})
+	output, err := cmd.Output()
+	if err != nil {
+		return cmd.Path, "", err
 	}
-	sessionDir = strings.ReplaceAll(sessionDir, " ", "_")
-	fullSessionDir := filepath.Join(config.GetVideoDir(), sessionDir)
-	if err := os.MkdirAll(fullSessionDir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create session directory: %w", err)
+	version := strings.SplitN(string(output), "\n", 2)[0]
+	return cmd.Path, strings.TrimSpace(version), nil
+}
+
+// createFfprobeCmd creates an exec.Cmd for the ffprobe found next to ffmpeg
+func createFfprobeCmd(args []string) *exec.Cmd {
+	ffmpeg := createFfmpegCmd(args)
+	dir, name := filepath.Split(ffmpeg.Path)
+	cmd := exec.Command(filepath.Join(dir, strings.Replace(name, "ffmpeg", "ffprobe", 1)), args...)
+	cmd.SysProcAttr = ffmpeg.SysProcAttr
+	return cmd
+}
+
+// probeDuration returns the duration of a video file in seconds
+func probeDuration(fileName string) (float64, error) {
+	cmd := createFfprobeCmd([]string{
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		fileName,
+	})
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
 	}
+	return strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+}
 
-	// Second pass: copy trimmed files to final destination
-	timestamp := time.Now().Format("2006-01-02_15h04m05s")
-	baseFileName := fmt.Sprintf("%s_%s_%s_attempt%d",
-		timestamp,
-		strings.ReplaceAll(state.CurrentAthlete, " ", "_"),
-		state.CurrentLiftType,
-		state.CurrentAttempt)
+// withProgress has ffmpeg arguments report the progress on stdout, the output file stays last
+func withProgress(args []string) []string {
+	last := len(args) - 1
+	result := append([]string{}, args[:last]...)
+	return append(result, "-progress", "pipe:1", "-nostats", args[last])
+}
 
-	var finalFiles []string
-	for _, trimmedFile := range trimmedFiles {
-		cameraNum := strings.TrimPrefix(filepath.Base(trimmedFile), "Camera")
-		cameraNum = strings.TrimSuffix(cameraNum, ".mp4")
-		finalFileName := filepath.Join(fullSessionDir, fmt.Sprintf("%s_Camera%s.mp4", baseFileName, cameraNum))
-		finalFiles = append(finalFiles, finalFileName)
+// runWithProgress runs an ffmpeg command whose arguments were given withProgress, and calls report
+// with the percentage of total seconds written each time it passes a multiple of 5. Without a
+// total, only the end is reported.
+func runWithProgress(cmd *exec.Cmd, total float64, report func(percent int)) error {
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
 
-		// Copy the MP4 file to final destination (using io.Copy to keep the original)
-		sourceFile, err := os.Open(trimmedFile)
-		if err != nil {
-			return fmt.Errorf("failed to open source file for Camera %s: %w", cameraNum, err)
+	lastPercent := -1
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "out_time_us=") || total <= 0 {
+			continue
 		}
-		defer sourceFile.Close()
-
-		destFile, err := os.Create(finalFileName)
+		us, err := strconv.ParseInt(strings.TrimPrefix(line, "out_time_us="), 10, 64)
 		if err != nil {
-			return fmt.Errorf("failed to create destination file for Camera %s: %w", cameraNum, err)
+			continue
 		}
-		defer destFile.Close()
-
-		if _, err := io.Copy(destFile, sourceFile); err != nil {
-			return fmt.Errorf("failed to copy video to final location for Camera %s: %w", cameraNum, err)
+		percent := int(float64(us) / 1e6 / total * 100)
+		if percent > 100 {
+			percent = 100
+		}
+		if percent/5 != lastPercent/5 {
+			lastPercent = percent
+			report(percent)
 		}
 	}
+	if err := cmd.Wait(); err != nil {
+		return err
+	}
+	if lastPercent < 100 {
+		report(100)
+	}
+	return nil
+}
 
-	// Final pass: remove original .flv files
-
-	// wait 5 seconds
-	time.Sleep(5 * time.Second)
+// webVideoCodecs and webAudioCodecs are the codecs all browsers play in an MP4
+var (
+	webVideoCodecs = map[string]bool{"h264": true}
+	webAudioCodecs = map[string]bool{"aac": true, "mp3": true}
+)
 
-	for _, sourceFile := range sourceFiles {
-		if err := os.Remove(sourceFile); err != nil {
-			logging.WarningLogger.Printf("Failed to remove source .flv file %s: %v", sourceFile, err)
+// isWebCompatible reports whether every stream of a recording plays in a browser
+func isWebCompatible(fileName string) (bool, error) {
+	cmd := createFfprobeCmd([]string{
+		"-v", "error",
+		"-show_entries", "stream=codec_type,codec_name",
+		"-of", "csv=p=0",
+		fileName,
+	})
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		codec, codecType, _ := strings.Cut(strings.TrimSpace(line), ",")
+		switch codecType {
+		case "video":
+			if !webVideoCodecs[codec] {
+				return false, nil
+			}
+		case "audio":
+			if !webAudioCodecs[codec] {
+				return false, nil
+			}
 		}
 	}
+	return true, nil
+}
 
-	httpServer.SendStatus(httpServer.Ready, "Videos ready")
-	logging.InfoLogger.Printf("Processed videos: %v", finalFiles)
+// hasAudio reports whether a recording has an audio stream
+func hasAudio(fileName string) (bool, error) {
+	cmd := createFfprobeCmd([]string{
+		"-v", "error",
+		"-select_streams", "a",
+		"-show_entries", "stream=index",
+		"-of", "csv=p=0",
+		fileName,
+	})
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	return strings.TrimSpace(string(output)) != "", nil
+}
 
-	return nil
+// normalizeLoudness adds an EBU R128 loudness normalization to ffmpeg arguments. The audio is
+// encoded to AAC, the video is left as it was, copied or encoded.
+func normalizeLoudness(args []string, targetLUFS float64) []string {
+	// loudnorm resamples to 192 kHz unless told otherwise
+	audio := []string{"-c:a", "aac", "-af", fmt.Sprintf("loudnorm=I=%g:TP=-1.5:LRA=11", targetLUFS), "-ar", "48000"}
+	var result []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c" && i+1 < len(args) && args[i+1] == "copy":
+			result = append(result, "-c:v", "copy")
+			result = append(result, audio...)
+			i++
+			continue
+		case args[i] == "-c:a" && i+1 < len(args):
+			result = append(result, audio...)
+			i++
+			continue
+		}
+		result = append(result, args[i])
+	}
+	return result
 }
 
-func ForceStopRecordings() {
-	if config.NoVideo {
-		for i, fileName := range currentFileNames {
-			logging.InfoLogger.Printf("Simulating forced stop recording video for Camera %d: %s", i+1, fileName)
+// reencodeForWeb replaces the stream copy in ffmpeg arguments by an H.264/AAC encoding
+func reencodeForWeb(args []string) []string {
+	return reencode(args, []string{
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-movflags", "+faststart"})
+}
+
+// convertFps has ffmpeg arguments output a constant frame rate. A stream copy is replaced by an
+// H.264/AAC encoding, the frame rate cannot be changed without encoding.
+func convertFps(args []string, fps float64) []string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-c" && args[i+1] == "copy" {
+			args = reencodeForWeb(args)
+			break
 		}
-	} else {
-		if err := obsClient.TriggerHotkey("OBS_KEY_F8"); err != nil {
-			logging.ErrorLogger.Printf("Failed to send F8 hotkey to OBS: %v", err)
+	}
+	rate := []string{"-r", fmt.Sprintf("%g", fps)}
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == "-c:v" {
+			// Right after the video encoder, options from ffmpegOutputParams still come later
+			return append(append(append([]string{}, args[:i+2]...), rate...), args[i+2:]...)
 		}
 	}
+	return append(append(append([]string{}, args[:len(args)-1]...), rate...), args[len(args)-1])
+}
+
+// reencode replaces the stream copy in ffmpeg arguments by the given encoding options. Options
+// from ffmpegOutputParams come later on the command line and take precedence.
+func reencode(args, encoding []string) []string {
+	var result []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" && i+1 < len(args) && args[i+1] == "copy" {
+			result = append(result, encoding...)
+			i++
+			continue
+		}
+		result = append(result, args[i])
+	}
+	return result
+}
+
+// TestOBSConnection opens and closes a separate connection to the OBS WebSocket server
+func TestOBSConnection() error {
+	client := NewOBSWebSocketClient()
+	err := client.Connect()
+	httpServer.ReportHealth("obsConnection", err)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// CameraPreview returns a JPEG snapshot of a camera for checking its framing. camera is a
+// camera number from cameraSources or the name of an OBS source or scene.
+func CameraPreview(camera string) ([]byte, error) {
+	if obsClient == nil {
+		return nil, fmt.Errorf("not connected to OBS")
+	}
+	sourceName := camera
+	if name, ok := config.GetCurrentConfig().CameraSources[camera]; ok {
+		sourceName = name
+	}
+	image, err := obsClient.GetSourceScreenshot(sourceName, 640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preview of %s: %w", sourceName, err)
+	}
+	return image, nil
+}
+
+// FinalizeInterruptedRecording stops OBS and files the camera files of a recording that was
+// in progress when the application was last stopped
+func FinalizeInterruptedRecording(snapshot *state.RecordingSnapshot) error {
+	logging.InfoLogger.Printf("Finalizing interrupted recording: %s - %s attempt %d",
+		snapshot.Athlete, snapshot.LiftType, snapshot.Attempt)
+	snapshot.Restore()
+	// The decision, if there was one, was not seen: only the persisted clock stop places the lift
+	return StopRecording(NoDecision)
 }
 
 // GetStartTimeMillis returns the start time in milliseconds
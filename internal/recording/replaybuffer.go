@@ -0,0 +1,145 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// replaySaveTimeout is how long OBS may take to write the replay buffer to a file
+const replaySaveTimeout = 10 * time.Second
+
+// fallbackRecording is set when the replay buffer could not be started for the attempt, which is
+// then recorded and stopped like without replayBuffer
+var (
+	fallbackMu        sync.Mutex
+	fallbackRecording bool
+)
+
+func setFallbackRecording(on bool) {
+	fallbackMu.Lock()
+	fallbackRecording = on
+	fallbackMu.Unlock()
+}
+
+// usingReplayBuffer reports whether the current attempt is kept by the replay buffer
+func usingReplayBuffer() bool {
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+	return config.GetCurrentConfig().ReplayBuffer && !fallbackRecording
+}
+
+// startReplayBuffer makes sure the OBS replay buffer is running, so that the attempt is kept
+func startReplayBuffer() error {
+	active, err := obsClient.GetReplayBufferStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get OBS replay buffer status: %w", err)
+	}
+	if active {
+		return nil
+	}
+	logging.InfoLogger.Println("Starting OBS replay buffer")
+	if err := obsClient.StartReplayBuffer(); err != nil {
+		return fmt.Errorf("failed to start OBS replay buffer: %w", err)
+	}
+	return nil
+}
+
+// saveReplayBuffer saves the OBS replay buffer and returns the saved clip and the time at which
+// the clip begins, in milliseconds
+func saveReplayBuffer() (string, int64, error) {
+	// OBS reports an error until a first replay has been saved
+	previous, _ := obsClient.GetLastReplayBufferReplay()
+
+	savedAt := time.Now().UnixNano() / int64(time.Millisecond)
+	if err := obsClient.SaveReplayBuffer(); err != nil {
+		return "", 0, fmt.Errorf("failed to save OBS replay buffer: %w", err)
+	}
+
+	// The file is written asynchronously, wait until OBS reports a new one
+	deadline := time.Now().Add(replaySaveTimeout)
+	var clip string
+	for {
+		path, err := obsClient.GetLastReplayBufferReplay()
+		if err == nil && path != "" && path != previous {
+			clip = path
+			break
+		}
+		if time.Now().After(deadline) {
+			return "", 0, fmt.Errorf("replay buffer not saved after %v", replaySaveTimeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// The clip ends when it was saved and lasts as long as the buffer held
+	duration, err := probeDuration(clip)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to determine duration of %s: %w", clip, err)
+	}
+	return clip, savedAt - int64(duration*1000), nil
+}
+
+// stopReplayBuffer saves the replay buffer and trims the saved clip like a recording
+func stopReplayBuffer(decisionTime int64, keepAll bool) error {
+	clip, clipStart, err := saveReplayBuffer()
+	if err != nil {
+		// The buffer may have been stopped in OBS, a recording made meanwhile still has the attempt
+		if recording, statusErr := obsClient.GetRecordStatus(); statusErr == nil && recording {
+			logging.WarningLogger.Printf("%v, using the OBS recording instead", err)
+			return stopOBSRecording(decisionTime, keepAll)
+		}
+		state.ClearRecordingInProgress(state.LastStartTime)
+		err = fmt.Errorf("attempt not kept, the replay buffer could not be saved: %w", err)
+		httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+
+		// Have the buffer running for the next attempt
+		if restartErr := startReplayBuffer(); restartErr != nil {
+			logging.ErrorLogger.Printf("Replay buffer still unavailable: %v", restartErr)
+		}
+		return err
+	}
+
+	// OBS names replays "Replay <date>" by default, file those as the first camera. The name is
+	// unique, a clip saved before the previous one is processed must not replace it.
+	if _, ok := cameraID(clip); !ok {
+		renamed := filepath.Join(filepath.Dir(clip),
+			fmt.Sprintf("Replay_%s_Camera1%s", time.UnixMilli(clipStart).Format("2006-01-02_15-04-05.000"), filepath.Ext(clip)))
+		if _, ok := cameraID(renamed); !ok {
+			state.ClearRecordingInProgress(state.LastStartTime)
+			err := fmt.Errorf("attempt not kept, replay %s cannot be named to match cameraFilePattern %q, set recordingFormat to the replay buffer format",
+				clip, config.GetCurrentConfig().CameraFilePattern)
+			httpServer.SendStatus(httpServer.Error, fmt.Sprintf("Error: %v", err))
+			return err
+		}
+		if err := os.Rename(clip, renamed); err != nil {
+			state.ClearRecordingInProgress(state.LastStartTime)
+			return fmt.Errorf("failed to rename replay %s: %w", clip, err)
+		}
+		if err := moveTiming(clip, renamed); err != nil {
+			logging.WarningLogger.Printf("Failed to rename the timing file of %s: %v", clip, err)
+		}
+		clip = renamed
+	}
+
+	// Bookmarks are relative to the start of the attempt, the clip starts earlier
+	bookmarks := state.EndBookmarks()
+	if state.LastStartTime > 0 {
+		for i := range bookmarks {
+			bookmarks[i] += state.LastStartTime - clipStart
+		}
+	}
+
+	job := newRecordingJob(filepath.Dir(clip), []string{clip}, decisionTime, bookmarks)
+	job.clipStart = clipStart
+	job.keepAll = keepAll
+	job.pipeline = httpServer.BeginPipeline(job.attemptInfo())
+	job.log.Info("Saved replay buffer to %s", clip)
+	return job.run()
+}
@@ -0,0 +1,108 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// Reset brings the recorder back to idle after it got stuck, without restarting or dropping the
+// owlcms and OBS connections: OBS is stopped, the attempt in progress is forgotten and the camera
+// files left in the captures directory are moved to its salvage folder. Recordings being trimmed
+// keep their files.
+func Reset() error {
+	if err := ForceStopRecordings(); err != nil {
+		logging.WarningLogger.Printf("Reset: could not stop the OBS recording: %v", err)
+	} else {
+		logging.InfoLogger.Println("Reset: stopped the OBS recording")
+	}
+
+	resetDebounce()
+	state.EndBookmarks()
+	state.DiscardInterruptedRecording()
+	state.LastStartTime = 0
+	state.LastTimerStopTime = 0
+	state.LastDecisionTime = 0
+	state.StopRequestCount = 0
+	state.ExpectedCameras = nil
+	logging.InfoLogger.Println("Reset: cleared the attempt in progress")
+
+	// Give OBS a moment to close the files it was writing
+	time.Sleep(time.Second)
+	err := cleanCaptureDir(GetCaptureDir())
+	if err != nil {
+		logging.ErrorLogger.Printf("Reset: %v", err)
+	}
+
+	httpServer.SendStatus(httpServer.Ready, "Ready (reset)")
+	logging.InfoLogger.Println("Reset done")
+	return err
+}
+
+// cleanCaptureDir moves the camera files left in the captures directory, with their timing files, to
+// a salvage folder and removes the trimmed work files. The files of recordings being processed
+// are left alone.
+func cleanCaptureDir(captureDir string) error {
+	files, err := os.ReadDir(captureDir)
+	if err != nil {
+		return fmt.Errorf("failed to read captures directory: %w", err)
+	}
+	if workDirInUse(captureDir) {
+		logging.InfoLogger.Println("Reset: recordings are being trimmed, keeping the trimmed videos")
+	} else if err := os.RemoveAll(filepath.Join(captureDir, trimmedDirName)); err != nil {
+		logging.WarningLogger.Printf("Reset: could not remove trimmed videos: %v", err)
+	}
+	salvageDir := filepath.Join(captureDir, salvageDirName, time.Now().Format("2006-01-02_15-04-05"))
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(captureDir, file.Name())
+		_, isCamera := cameraID(file.Name())
+		switch {
+		case isCamera && sourceInUse(path):
+			logging.InfoLogger.Printf("Reset: %s is being processed, left in place", path)
+		case isCamera:
+			// Never destroy footage, the attempt may still be wanted
+			salvaged := filepath.Join(salvageDir, file.Name())
+			if err := moveFile(path, salvaged); err != nil {
+				logging.WarningLogger.Printf("Reset: could not move %s to %s: %v", path, salvageDir, err)
+				continue
+			}
+			if err := moveTiming(path, salvaged); err != nil {
+				logging.WarningLogger.Printf("Reset: could not move the timing file of %s: %v", path, err)
+			}
+			logging.InfoLogger.Printf("Reset: moved %s to %s", path, salvageDir)
+		}
+	}
+
+	// What is left is work files and timing files without a camera file
+	files, err = os.ReadDir(captureDir)
+	if err != nil {
+		return fmt.Errorf("failed to read captures directory: %w", err)
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(captureDir, file.Name())
+		_, isCamera := cameraID(file.Name())
+		isWork, _ := filepath.Match("Camera*.mp4", file.Name())
+		isTiming := strings.HasSuffix(file.Name(), timingSuffix)
+		if isCamera || (!isWork && !isTiming) || timingInUse(path) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			logging.WarningLogger.Printf("Reset: could not remove %s: %v", path, err)
+			continue
+		}
+		logging.InfoLogger.Printf("Reset: removed %s", path)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package recording
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/httpServer"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// SelfTest trims a generated clip with the same ffmpeg arguments as real recordings, including
+// web encoding, output profiles and vertical videos, so that an unsupported encoder or bad
+// parameters are found before the first lift. The result is logged and reported by /api/health.
+func SelfTest() error {
+	err := runSelfTest()
+	if err != nil {
+		logging.ErrorLogger.Printf("ffmpeg self-test failed: %v", err)
+	} else {
+		logging.InfoLogger.Println("ffmpeg self-test passed")
+	}
+	httpServer.ReportHealth("ffmpegSelfTest", err)
+	return err
+}
+
+// runSelfTest produces every output of a recording from a short test pattern
+func runSelfTest() error {
+	dir, err := os.MkdirTemp("", "obsreplays-selftest-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A 3 second clip with the codecs OBS records by default
+	clip := filepath.Join(dir, "Camera1.flv")
+	if err := runFfmpeg("generating test clip", []string{"-y",
+		"-f", "lavfi", "-i", "testsrc=duration=3:size=320x240:rate=25",
+		"-f", "lavfi", "-i", "sine=duration=3",
+		"-c:v", "libx264", "-pix_fmt", "yuv420p", "-c:a", "aac",
+		"-f", "flv", clip,
+	}); err != nil {
+		return err
+	}
+
+	cfg := config.GetCurrentConfig()
+	trimmed := filepath.Join(dir, "Camera1.mp4")
+	args := buildTrimmingArgs(1000, clip, trimmed)
+	if cfg.FixedDuration > 0 {
+		args = buildTailArgs(cfg.FixedDuration, clip, trimmed)
+	}
+	if quality := cfg.QualityArgs(); quality != nil {
+		args = reencode(args, quality)
+	} else if cfg.WebCompatible {
+		// Exercise the encoder even though the test clip would be copied
+		args = reencodeForWeb(args)
+	}
+	if cfg.OutputFps > 0 {
+		args = convertFps(args, cfg.OutputFps)
+	}
+	if cfg.LoudnessTarget != 0 {
+		args = normalizeLoudness(args, cfg.LoudnessTarget)
+	}
+	if err := runFfmpeg("trimming", args); err != nil {
+		return err
+	}
+	outputs := []string{trimmed}
+
+	for _, profile := range cfg.Profiles {
+		output := filepath.Join(dir, fmt.Sprintf("Camera1_%s.%s", profile.Name, profile.Format))
+		if err := runFfmpeg("profile "+profile.Name, buildProfileArgs(profile, trimmed, output)); err != nil {
+			return err
+		}
+		outputs = append(outputs, output)
+	}
+	for camera, crop := range cfg.Vertical {
+		output := filepath.Join(dir, fmt.Sprintf("Camera%s_vertical.mp4", camera))
+		if err := runFfmpeg("vertical video for camera "+camera, buildVerticalArgs(crop, trimmed, output)); err != nil {
+			return err
+		}
+		outputs = append(outputs, output)
+	}
+
+	// Every output must decode from start to end
+	for _, output := range outputs {
+		if err := runFfmpeg("playing "+filepath.Base(output), []string{"-v", "error", "-i", output, "-f", "null", "-"}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runFfmpeg runs ffmpeg and returns an error with the last line it printed when it fails
+func runFfmpeg(step string, args []string) error {
+	cmd := createFfmpegCmd(args)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		return fmt.Errorf("%s: %v: %s", step, err, strings.TrimSpace(lines[len(lines)-1]))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package recording
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// Index files written in each session folder with sessionIndex, links are relative to the folder
+const (
+	sessionIndexHTML = "index.html"
+	sessionIndexM3U  = "playlist.m3u"
+)
+
+// sessionIndexMu keeps attempts filed at the same time from writing the index together
+var sessionIndexMu sync.Mutex
+
+// indexEntry is an attempt as listed in the index files
+type indexEntry struct {
+	Time     string
+	Athlete  string
+	LiftType string
+	Attempt  int
+	Weight   int
+	Decision string
+	Files    []indexFile
+}
+
+// indexFile is a video of an attempt, Path is relative to the session folder with forward slashes
+type indexFile struct {
+	Name string
+	Path string
+	URL  string
+}
+
+var sessionIndexTemplate = template.Must(template.New(sessionIndexHTML).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Session}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>{{.Session}}</h1>
+<p><a href="` + sessionIndexM3U + `">Playlist</a></p>
+<table>
+<tr><th>Time</th><th>Athlete</th><th>Lift</th><th>Attempt</th><th>Weight</th><th>Decision</th><th>Videos</th></tr>
+{{range .Entries}}<tr><td>{{.Time}}</td><td>{{.Athlete}}</td><td>{{.LiftType}}</td><td>{{.Attempt}}</td><td>{{if .Weight}}{{.Weight}} kg{{end}}</td><td>{{.Decision}}</td><td>{{range .Files}}<a href="{{.URL}}">{{.Name}}</a><br>{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// updateSessionIndex rewrites the index files of a session folder from its replay manifests, when
+// sessionIndex is set. The files are replaced at once, a coach opening them never sees half of one.
+func updateSessionIndex(sessionDir string) {
+	if !config.GetCurrentConfig().SessionIndex || filepath.Base(sessionDir) == "unsorted" {
+		return
+	}
+	sessionIndexMu.Lock()
+	defer sessionIndexMu.Unlock()
+	if err := writeSessionIndex(sessionDir); err != nil {
+		logging.WarningLogger.Printf("Failed to update the index of %s: %v", sessionDir, err)
+	}
+}
+
+// writeSessionIndex writes the HTML page and the M3U playlist of a session folder
+func writeSessionIndex(sessionDir string) error {
+	session, err := filepath.Rel(config.GetVideoDir(), sessionDir)
+	if err != nil {
+		return err
+	}
+	replays, err := config.SessionReplays(filepath.ToSlash(session))
+	if err != nil {
+		return err
+	}
+
+	var entries []indexEntry
+	for _, replay := range replays {
+		manifest := replay.Manifest
+		folder, err := filepath.Rel(sessionDir, filepath.Join(config.GetVideoDir(), filepath.FromSlash(replay.Dir)))
+		if err != nil {
+			return err
+		}
+		entry := indexEntry{
+			Time:     manifest.Created.Format("2006-01-02 15:04:05"),
+			Athlete:  strings.ReplaceAll(manifest.Athlete, "_", " "),
+			LiftType: manifest.LiftType,
+			Attempt:  manifest.Attempt,
+			Weight:   manifest.Weight,
+			Decision: manifest.Decision,
+		}
+		for _, name := range manifest.Files {
+			if !strings.HasSuffix(name, ".mp4") {
+				continue
+			}
+			file := indexFile{Name: name, Path: path.Join(filepath.ToSlash(folder), name), URL: url.PathEscape(name)}
+			if folder != "." {
+				file.URL = url.PathEscape(filepath.ToSlash(folder)) + "/" + file.URL
+			}
+			entry.Files = append(entry.Files, file)
+		}
+		entries = append(entries, entry)
+	}
+
+	var page bytes.Buffer
+	if err := sessionIndexTemplate.Execute(&page, struct {
+		Session string
+		Entries []indexEntry
+	}{filepath.ToSlash(session), entries}); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(sessionDir, sessionIndexHTML), page.Bytes()); err != nil {
+		return err
+	}
+
+	var m3u bytes.Buffer
+	m3u.WriteString("#EXTM3U\n")
+	for _, entry := range entries {
+		for _, file := range entry.Files {
+			fmt.Fprintf(&m3u, "#EXTINF:-1,%s - %s attempt %d - %s\n", entry.Athlete, entry.LiftType, entry.Attempt, file.Name)
+			fmt.Fprintf(&m3u, "%s\n", file.Path)
+		}
+	}
+	return writeFileAtomic(filepath.Join(sessionDir, sessionIndexM3U), m3u.Bytes())
+}
+
+// writeFileAtomic writes a file under a temporary name and renames it into place
+func writeFileAtomic(fileName string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package recording
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/owlcms/obsreplays/internal/config"
+)
+
+// disposeSources deletes, archives or keeps the camera files of the job according to
+// sourceRetention. Archived files go to the raw folder of the session directory and are named
+// after the replay, kept files go to the kept folder of the captures directory so that the next
+// recording does not pick them up. The failed files could not be trimmed and are always archived.
+func (job *recordingJob) disposeSources(sessionDir, baseFileName string, failed []string) {
+	retention := config.GetCurrentConfig().SourceRetention
+	for _, sourceFile := range job.sourceFiles {
+		isFailed := false
+		for _, f := range failed {
+			if f == sourceFile {
+				isFailed = true
+				break
+			}
+		}
+		switch {
+		case retention == config.SourceArchive || isFailed:
+			name := filepath.Base(sourceFile)
+			if camera, ok := cameraID(sourceFile); ok {
+				name = fmt.Sprintf("%s_Camera%s%s", baseFileName, camera, filepath.Ext(sourceFile))
+			}
+			archived := filepath.Join(sessionDir, "raw", name)
+			if err := moveFile(sourceFile, archived); err != nil {
+				job.log.Warning("Failed to archive source file %s to %s: %v", sourceFile, archived, err)
+				continue
+			}
+			if err := moveTiming(sourceFile, archived); err != nil {
+				job.log.Warning("Failed to archive the timing file of %s: %v", sourceFile, err)
+			}
+			job.log.Info("Archived source file %s to %s", sourceFile, archived)
+		case retention == config.SourceKeep:
+			kept := filepath.Join(GetCaptureDir(), "kept", filepath.Base(sourceFile))
+			if err := moveFile(sourceFile, kept); err != nil {
+				job.log.Warning("Failed to keep source file %s in %s: %v", sourceFile, filepath.Dir(kept), err)
+				continue
+			}
+			if err := moveTiming(sourceFile, kept); err != nil {
+				job.log.Warning("Failed to keep the timing file of %s: %v", sourceFile, err)
+			}
+			job.log.Info("Kept source file %s as %s", sourceFile, kept)
+		default:
+			if err := os.Remove(sourceFile); err != nil {
+				job.log.Warning("Failed to remove source file %s: %v", sourceFile, err)
+				continue
+			}
+			if err := os.Remove(timingFile(sourceFile)); err != nil && !os.IsNotExist(err) {
+				job.log.Warning("Failed to remove the timing file of %s: %v", sourceFile, err)
+			}
+			job.log.Info("Deleted source file %s", sourceFile)
+		}
+	}
+}
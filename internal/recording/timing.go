@@ -0,0 +1,84 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// timingSuffix ends the name of the timing sidecar of a camera file: Camera1.flv has Camera1.timing.json
+const timingSuffix = ".timing.json"
+
+// maxTimingOffset is the largest believable difference between the first frame of a camera and the
+// start of the recording, a sidecar further off is taken as left from another recording
+const maxTimingOffset = 10 * time.Second
+
+// cameraTiming is the content of a timing sidecar, Start is the wall-clock time of the first frame
+type cameraTiming struct {
+	Start time.Time `json:"start"`
+}
+
+// timingFile returns the name of the timing sidecar of a camera file
+func timingFile(cameraFile string) string {
+	return strings.TrimSuffix(cameraFile, filepath.Ext(cameraFile)) + timingSuffix
+}
+
+// readTiming returns the time of the first frame of a camera file from its timing sidecar. found is
+// false when the camera has no sidecar.
+func readTiming(cameraFile string) (start time.Time, found bool, err error) {
+	data, err := os.ReadFile(timingFile(cameraFile))
+	if os.IsNotExist(err) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	var timing cameraTiming
+	if err := json.Unmarshal(data, &timing); err != nil {
+		return time.Time{}, true, fmt.Errorf("invalid timing file %s: %w", timingFile(cameraFile), err)
+	}
+	if timing.Start.IsZero() {
+		return time.Time{}, true, fmt.Errorf("timing file %s has no start", timingFile(cameraFile))
+	}
+	return timing.Start, true, nil
+}
+
+// alignedTrim returns the trim of a camera, in milliseconds, that starts its replay at the same
+// moment as the other cameras. trimDuration is measured from origin, the start of the recording;
+// a camera whose sidecar says it began later has less to trim. Without a usable sidecar
+// trimDuration is kept.
+func (job *recordingJob) alignedTrim(sourceFile, cameraNum string, trimDuration, origin int64) int64 {
+	start, found, err := readTiming(sourceFile)
+	if !found {
+		return trimDuration
+	}
+	if err != nil {
+		job.log.Warning("Camera %s: %v, trimming from the start of the file", cameraNum, err)
+		return trimDuration
+	}
+	offset := start.UnixMilli() - origin
+	if offset > maxTimingOffset.Milliseconds() || -offset > maxTimingOffset.Milliseconds() {
+		job.log.Warning("Camera %s: timing file is %.1fs from the start of the recording, ignoring it",
+			cameraNum, float64(offset)/1000)
+		return trimDuration
+	}
+	aligned := trimDuration - offset
+	if aligned < 0 {
+		aligned = 0
+	}
+	job.log.Info("Camera %s: first frame %+.3fs from the start of the recording, trimming %.3fs",
+		cameraNum, float64(offset)/1000, float64(aligned)/1000)
+	return aligned
+}
+
+// moveTiming moves the timing sidecar of a camera file, if it has one, next to where the camera
+// file was moved
+func moveTiming(cameraFile, movedTo string) error {
+	if _, err := os.Stat(timingFile(cameraFile)); err != nil {
+		return nil
+	}
+	return moveFile(timingFile(cameraFile), timingFile(movedTo))
+}
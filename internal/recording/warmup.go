@@ -0,0 +1,152 @@
+package recording
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/config"
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// The warm-up recorder captures a camera continuously with its own ffmpeg, independently of OBS and
+// of the attempt-driven recordings, and cuts the stream into fixed-length files.
+
+var (
+	warmupMu      sync.Mutex
+	warmupCmd     *exec.Cmd
+	warmupStdin   io.WriteCloser
+	warmupStopped chan struct{}
+	warmupDone    chan struct{}
+)
+
+// buildWarmupArgs builds the ffmpeg arguments recording the warm-up camera in rolling segments
+func buildWarmupArgs(warmup config.WarmupRecording, dir string) []string {
+	var args []string
+	if warmup.Format != "" {
+		args = append(args, "-f", warmup.Format)
+	}
+	args = append(args, strings.Fields(warmup.InputParams)...)
+	args = append(args, "-i", warmup.Input)
+	if warmup.Params != "" {
+		args = append(args, strings.Fields(warmup.Params)...)
+	} else {
+		args = append(args, "-c", "copy")
+	}
+	args = append(args,
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%d", warmup.SegmentMinutes*60),
+		"-reset_timestamps", "1",
+		"-strftime", "1",
+		filepath.Join(dir, "warmup_%Y-%m-%d_%Hh%Mm%Ss.mp4"),
+	)
+	return args
+}
+
+// StartWarmupRecording starts the continuous warm-up recording if one is configured.
+// ffmpeg is restarted with increasing delays if it exits, e.g. when the camera is unplugged.
+func StartWarmupRecording() error {
+	warmup := config.GetCurrentConfig().Warmup
+	if warmup.Input == "" {
+		return nil
+	}
+	dir := warmup.Dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(config.GetVideoDir(), dir)
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create warm-up directory: %w", err)
+	}
+
+	warmupMu.Lock()
+	defer warmupMu.Unlock()
+	if warmupStopped != nil {
+		return nil
+	}
+	warmupStopped = make(chan struct{})
+	warmupDone = make(chan struct{})
+	go runWarmupRecorder(buildWarmupArgs(warmup, dir), dir, warmupStopped, warmupDone)
+	return nil
+}
+
+// runWarmupRecorder keeps ffmpeg running until stopped is closed
+func runWarmupRecorder(args []string, dir string, stopped, done chan struct{}) {
+	defer close(done)
+	delay := time.Second
+	for {
+		cmd := createFfmpegCmd(args)
+		stdin, err := cmd.StdinPipe()
+		if err == nil {
+			logging.InfoLogger.Printf("Starting warm-up recording to %s: %s", dir, cmd.String())
+			err = cmd.Start()
+		}
+		if err == nil {
+			warmupMu.Lock()
+			warmupCmd, warmupStdin = cmd, stdin
+			warmupMu.Unlock()
+			select {
+			case <-stopped:
+				// Stopped while ffmpeg was starting
+				io.WriteString(stdin, "q")
+			default:
+			}
+
+			started := time.Now()
+			err = cmd.Wait()
+			if time.Since(started) > time.Minute {
+				// It ran properly for a while, retry quickly
+				delay = time.Second
+			}
+		}
+
+		select {
+		case <-stopped:
+			logging.InfoLogger.Printf("Warm-up recording stopped")
+			return
+		default:
+		}
+
+		logging.ErrorLogger.Printf("Warm-up recording interrupted, restarting in %v: %v", delay, err)
+		select {
+		case <-stopped:
+			return
+		case <-time.After(delay):
+		}
+		if delay < time.Minute {
+			delay *= 2
+		}
+	}
+}
+
+// StopWarmupRecording asks ffmpeg to finish the current segment and waits for it to exit
+func StopWarmupRecording() {
+	warmupMu.Lock()
+	if warmupStopped == nil {
+		warmupMu.Unlock()
+		return
+	}
+	close(warmupStopped)
+	cmd, stdin, done := warmupCmd, warmupStdin, warmupDone
+	warmupStopped = nil
+	warmupMu.Unlock()
+
+	if stdin != nil {
+		// "q" makes ffmpeg close the segment properly
+		io.WriteString(stdin, "q")
+		stdin.Close()
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		logging.WarningLogger.Printf("Warm-up recording did not stop, killing ffmpeg")
+		if cmd != nil && cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		<-done
+	}
+}
@@ -0,0 +1,56 @@
+package state
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotRecording is returned when a bookmark is added while nothing is being recorded
+var ErrNotRecording = errors.New("no recording in progress")
+
+var (
+	bookmarksMu sync.Mutex
+	// recordingStart is the wall-clock start of the attempt in milliseconds, the moment the trim is
+	// measured from, 0 when not recording
+	recordingStart int64
+	// bookmarks are offsets from recordingStart in milliseconds
+	bookmarks []int64
+)
+
+// BeginBookmarks starts collecting bookmarks for an attempt started at start, a wall-clock time in
+// milliseconds such as LastStartTime. Without one the current time is used.
+func BeginBookmarks(start int64) {
+	bookmarksMu.Lock()
+	defer bookmarksMu.Unlock()
+	if start == 0 {
+		start = time.Now().UnixNano() / int64(time.Millisecond)
+	}
+	recordingStart = start
+	bookmarks = nil
+}
+
+// AddBookmark marks a moment of the current recording. A negative offset marks the current moment,
+// read from the same wall clock as the start. It returns the offset of the mark from the start.
+func AddBookmark(offsetMs int64) (int64, error) {
+	bookmarksMu.Lock()
+	defer bookmarksMu.Unlock()
+	if recordingStart == 0 {
+		return 0, ErrNotRecording
+	}
+	if offsetMs < 0 {
+		offsetMs = time.Now().UnixNano()/int64(time.Millisecond) - recordingStart
+	}
+	bookmarks = append(bookmarks, offsetMs)
+	return offsetMs, nil
+}
+
+// EndBookmarks stops collecting bookmarks and returns those of the recording that ended
+func EndBookmarks() []int64 {
+	bookmarksMu.Lock()
+	defer bookmarksMu.Unlock()
+	marks := bookmarks
+	recordingStart = 0
+	bookmarks = nil
+	return marks
+}
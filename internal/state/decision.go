@@ -0,0 +1,95 @@
+package state
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// Values of LastDecision
+const (
+	DecisionUnknown = ""
+	DecisionGood    = "good"
+	DecisionBad     = "bad"
+)
+
+// LastDecision is the referee decision of the current attempt, DecisionUnknown until it is received
+var LastDecision string
+
+// decisionMessage holds the fields of a refereesDecision payload that give the outcome, either as
+// an overall decision or as the three referee lights
+type decisionMessage struct {
+	Decision interface{} `json:"decision"`
+	GoodLift interface{} `json:"goodLift"`
+	D1       interface{} `json:"d1"`
+	D2       interface{} `json:"d2"`
+	D3       interface{} `json:"d3"`
+}
+
+// UpdateStateFromDecisionMessage records the outcome of the attempt from a refereesDecision
+// payload, leaving it unknown when the payload does not tell
+func UpdateStateFromDecisionMessage(message string) {
+	LastDecision = parseDecision(message)
+	if LastDecision == DecisionUnknown {
+		logging.Trace("No good or bad lift in decision message: %s", message)
+	} else {
+		logging.InfoLogger.Printf("Decision for %s: %s lift", CurrentAthlete, LastDecision)
+	}
+}
+
+// parseDecision reads a plain text or JSON decision
+func parseDecision(message string) string {
+	message = strings.TrimSpace(message)
+	if d := decisionValue(message); d != DecisionUnknown {
+		return d
+	}
+
+	var msg decisionMessage
+	if err := json.Unmarshal([]byte(message), &msg); err != nil {
+		return DecisionUnknown
+	}
+	if d := decisionValue(msg.Decision); d != DecisionUnknown {
+		return d
+	}
+	if d := decisionValue(msg.GoodLift); d != DecisionUnknown {
+		return d
+	}
+
+	// Two white lights make a good lift
+	good, bad := 0, 0
+	for _, light := range []interface{}{msg.D1, msg.D2, msg.D3} {
+		switch decisionValue(light) {
+		case DecisionGood:
+			good++
+		case DecisionBad:
+			bad++
+		}
+	}
+	switch {
+	case good >= 2:
+		return DecisionGood
+	case bad >= 2:
+		return DecisionBad
+	}
+	return DecisionUnknown
+}
+
+// decisionValue interprets a single value: true/false or words such as good, bad, GOOD_LIFT, no lift
+func decisionValue(v interface{}) string {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return DecisionGood
+		}
+		return DecisionBad
+	case string:
+		switch strings.NewReplacer("_", "", " ", "", "-", "").Replace(strings.ToLower(v)) {
+		case "good", "goodlift", "white", "true":
+			return DecisionGood
+		case "bad", "nolift", "badlift", "red", "false":
+			return DecisionBad
+		}
+	}
+	return DecisionUnknown
+}
@@ -0,0 +1,122 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// stateFile keeps the in-progress recording so that it can be finalized after a crash
+var stateFile string
+
+// RecordingSnapshot is the minimal context needed to finalize a recording after a restart
+type RecordingSnapshot struct {
+	InProgress    bool   `json:"inProgress"`
+	Athlete       string `json:"athlete"`
+	LiftType      string `json:"liftType"`
+	Attempt       int    `json:"attempt"`
+	Session       string `json:"session"`
+	StartTime     int64  `json:"startTime"`
+	TimerStopTime int64  `json:"timerStopTime"`
+
+	ExpectedCameras []string `json:"expectedCameras,omitempty"`
+}
+
+// SetStateFile sets the file used to persist in-progress recordings across restarts
+func SetStateFile(path string) {
+	stateFile = path
+}
+
+// SaveRecordingInProgress persists the current attempt as an in-progress recording
+func SaveRecordingInProgress() {
+	if stateFile == "" {
+		return
+	}
+	snapshot := RecordingSnapshot{
+		InProgress:    true,
+		Athlete:       CurrentAthlete,
+		LiftType:      CurrentLiftType,
+		Attempt:       CurrentAttempt,
+		Session:       CurrentSession,
+		StartTime:     LastStartTime,
+		TimerStopTime: LastTimerStopTime,
+
+		ExpectedCameras: ExpectedCameras,
+	}
+	writeSnapshot(snapshot)
+}
+
+// SaveTimerStop adds the clock stop to the persisted recording of the current attempt, so that a
+// recording finalized after a crash is still trimmed around the lift
+func SaveTimerStop() {
+	snapshot := LoadInterruptedRecording()
+	if snapshot == nil || snapshot.StartTime != LastStartTime {
+		return
+	}
+	snapshot.TimerStopTime = LastTimerStopTime
+	writeSnapshot(*snapshot)
+}
+
+// writeSnapshot writes the in-progress recording to the state file
+func writeSnapshot(snapshot RecordingSnapshot) {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		logging.ErrorLogger.Printf("Failed to encode recording state: %v", err)
+		return
+	}
+	if err := os.WriteFile(stateFile, data, 0644); err != nil {
+		logging.ErrorLogger.Printf("Failed to save recording state to %s: %v", stateFile, err)
+	}
+}
+
+// ClearRecordingInProgress removes the persisted recording once the attempt that started at
+// startTime has been finalized, leaving a newer recording in place
+func ClearRecordingInProgress(startTime int64) {
+	snapshot := LoadInterruptedRecording()
+	if snapshot == nil || snapshot.StartTime != startTime {
+		return
+	}
+	DiscardInterruptedRecording()
+}
+
+// DiscardInterruptedRecording removes the persisted recording unconditionally
+func DiscardInterruptedRecording() {
+	if stateFile == "" {
+		return
+	}
+	if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+		logging.WarningLogger.Printf("Failed to remove recording state %s: %v", stateFile, err)
+	}
+}
+
+// LoadInterruptedRecording returns the recording left in progress by a previous run, or nil
+func LoadInterruptedRecording() *RecordingSnapshot {
+	if stateFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil
+	}
+	var snapshot RecordingSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		logging.WarningLogger.Printf("Ignoring unreadable recording state %s: %v", stateFile, err)
+		return nil
+	}
+	if !snapshot.InProgress {
+		return nil
+	}
+	return &snapshot
+}
+
+// Restore makes the snapshot the current attempt
+func (snapshot *RecordingSnapshot) Restore() {
+	CurrentAthlete = snapshot.Athlete
+	CurrentLiftType = snapshot.LiftType
+	CurrentAttempt = snapshot.Attempt
+	CurrentSession = snapshot.Session
+	LastStartTime = snapshot.StartTime
+	LastTimerStopTime = snapshot.TimerStopTime
+	ExpectedCameras = snapshot.ExpectedCameras
+}
@@ -2,6 +2,8 @@ package state
 
 import (
 	"encoding/json"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,9 +19,12 @@ var (
 	CurrentAthlete      string
 	CurrentLiftType     string
 	CurrentAttempt      int
+	CurrentWeight       int // Weight of the attempt in kg, 0 if owlcms did not send it
 	StopRequestCount    int
 	CurrentCameraNumber int
-	CurrentSession      string // Current competition session name
+	CurrentSession      string            // Current competition session name
+	CurrentFields       map[string]string // Other fields of the start message (team, category...), by name
+	ExpectedCameras     []string          // Cameras that should produce a file for the current recording
 	AvailablePlatforms  []string
 )
 
@@ -58,8 +63,23 @@ func UpdateStateFromStartMessage(message string) {
 	CurrentAttempt = startMsg.AttemptNumber
 	CurrentLiftType = startMsg.LiftType
 	CurrentSession = startMsg.Session // Update session from message
+	CurrentFields = extraFields(jsonPart)
+	CurrentWeight = attemptWeight(jsonPart)
 	LastStartTime = parseTime(timePart)
+	LastTimerStopTime = 0 // the clock runs again, a stop of the previous attempt no longer applies
 	StopRequestCount = 0
+	LastDecision = DecisionUnknown
+}
+
+// ParseStartMessage reads the attempt of a start message without changing the state
+func ParseStartMessage(message string) (StartMessage, error) {
+	var startMsg StartMessage
+	spaceIndex := strings.LastIndex(message, " ")
+	if spaceIndex == -1 {
+		return startMsg, fmt.Errorf("no timestamp in start message")
+	}
+	err := json.Unmarshal([]byte(message[:spaceIndex]), &startMsg)
+	return startMsg, err
 }
 
 func UpdateStateFromStopMessage(message string) {
@@ -67,8 +87,69 @@ func UpdateStateFromStopMessage(message string) {
 	if StopRequestCount == 1 {
 		LastTimerStopTime = time.Now().UnixNano() / int64(time.Millisecond)
 		logging.InfoLogger.Println("Stop time recorded")
+		SaveTimerStop()
+	}
+}
+
+// extraFields returns the simple values of a start message other than those of StartMessage, as
+// text, so that information owlcms adds (team, category, record attempt...) can be used in names
+func extraFields(jsonPart string) map[string]string {
+	var all map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonPart), &all); err != nil {
+		return nil
 	}
+	fields := make(map[string]string)
+	for name, value := range all {
+		switch name {
+		case "athleteName", "attemptNumber", "liftType", "session":
+			continue
+		}
+		if isWeightField(name) {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			fields[name] = value
+		case float64, bool:
+			fields[name] = fmt.Sprint(value)
+		}
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
 
+// weightFields are the names under which owlcms versions send the weight of the attempt
+var weightFields = []string{"weight", "requestedWeight", "attemptedWeight"}
+
+func isWeightField(name string) bool {
+	for _, field := range weightFields {
+		if name == field {
+			return true
+		}
+	}
+	return false
+}
+
+// attemptWeight returns the weight of the attempt from a start message, sent as a number or as
+// text, 0 if absent
+func attemptWeight(jsonPart string) int {
+	var all map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonPart), &all); err != nil {
+		return 0
+	}
+	for _, field := range weightFields {
+		switch value := all[field].(type) {
+		case float64:
+			return int(value)
+		case string:
+			if weight, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(value, "kg"))); err == nil {
+				return weight
+			}
+		}
+	}
+	return 0
 }
 
 func parseTime(_ string) int64 {
@@ -0,0 +1,32 @@
+package trigger
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+)
+
+// listen accepts connections on a unix domain socket
+func listen(address string) error {
+	// Remove a stale socket left behind by a previous run
+	if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen on unix socket: %w", err)
+	}
+	defer listener.Close()
+
+	logging.InfoLogger.Printf("Listening for local trigger commands on unix socket %s", address)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go serve(conn)
+	}
+}
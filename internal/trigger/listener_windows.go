@@ -0,0 +1,37 @@
+//go:build windows && !darwin && !linux
+
+package trigger
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+	"golang.org/x/sys/windows"
+)
+
+// listen accepts connections on a named pipe such as \\.\pipe\obsreplays
+func listen(address string) error {
+	name, err := windows.UTF16PtrFromString(address)
+	if err != nil {
+		return fmt.Errorf("invalid pipe name: %w", err)
+	}
+
+	logging.InfoLogger.Printf("Listening for local trigger commands on named pipe %s", address)
+	for {
+		// Each client gets its own pipe instance
+		handle, err := windows.CreateNamedPipe(name,
+			windows.PIPE_ACCESS_DUPLEX,
+			windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT,
+			windows.PIPE_UNLIMITED_INSTANCES, 4096, 4096, 0, nil)
+		if err != nil {
+			return fmt.Errorf("failed to create named pipe: %w", err)
+		}
+
+		if err := windows.ConnectNamedPipe(handle, nil); err != nil && err != windows.ERROR_PIPE_CONNECTED {
+			windows.CloseHandle(handle)
+			return fmt.Errorf("failed to accept connection: %w", err)
+		}
+		go serve(os.NewFile(uintptr(handle), address))
+	}
+}
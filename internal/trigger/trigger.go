@@ -0,0 +1,77 @@
+// Package trigger lets local control software drive recordings without owlcms or HTTP.
+// Commands are read one per line from a unix socket (Linux) or a named pipe (Windows):
+//
+//	START [athlete name]
+//	STOP [athlete name]
+//
+// Each command is answered with a single "OK" or "ERROR <reason>" line.
+package trigger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/owlcms/obsreplays/internal/logging"
+	"github.com/owlcms/obsreplays/internal/recording"
+	"github.com/owlcms/obsreplays/internal/state"
+)
+
+// Listen accepts trigger commands on the given socket path or pipe name until an error occurs
+func Listen(address string) {
+	if address == "" {
+		return
+	}
+	if err := listen(address); err != nil {
+		logging.ErrorLogger.Printf("Local trigger listener on %s stopped: %v", address, err)
+	}
+}
+
+// serve reads commands from a connected client and writes back one reply line per command
+func serve(conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		reply := "OK"
+		if err := handleCommand(line); err != nil {
+			logging.ErrorLogger.Printf("Local trigger command %q failed: %v", line, err)
+			reply = "ERROR " + err.Error()
+		}
+		if _, err := fmt.Fprintln(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// handleCommand executes a single START or STOP command
+func handleCommand(line string) error {
+	logging.InfoLogger.Printf("Local trigger command: %s", line)
+
+	command, athlete, _ := strings.Cut(line, " ")
+	athlete = strings.TrimSpace(athlete)
+	if athlete != "" {
+		state.CurrentAthlete = athlete
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	switch strings.ToUpper(command) {
+	case "START":
+		state.LastStartTime = now
+		state.StopRequestCount = 0
+		return recording.StartRecording(state.CurrentAthlete, state.CurrentLiftType, state.CurrentAttempt)
+	case "STOP":
+		// There is no clock information from an external trigger, the whole recording is kept
+		state.LastTimerStopTime = 0
+		state.LastDecisionTime = 0
+		return recording.StopRecording(recording.NoDecision)
+	default:
+		return fmt.Errorf("unknown command %q, expected START or STOP", command)
+	}
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // PlatformConfig represents platform-specific configurations
 type PlatformConfig struct {
 	FfmpegPath   string `toml:"ffmpegPath"`
@@ -9,3 +11,23 @@ type PlatformConfig struct {
 	Size         string `toml:"size"`
 	Fps          int    `toml:"fps"`
 }
+
+// ReplayManifest describes a replay and is written next to its video files
+type ReplayManifest struct {
+	Athlete  string            `json:"athlete"`
+	LiftType string            `json:"liftType"`
+	Attempt  int               `json:"attempt"`
+	Weight   int               `json:"weight,omitempty"` // kg, 0 if not sent by owlcms
+	Session  string            `json:"session"`
+	Decision string            `json:"decision,omitempty"` // good or bad, empty if not received
+	Fields   map[string]string `json:"fields,omitempty"`   // other information sent by owlcms
+	Created  time.Time         `json:"created"`
+	Files    []string          `json:"files"`
+	Chapters []ReplayChapter   `json:"chapters"`
+}
+
+// ReplayChapter is a bookmarked moment, in seconds from the start of the replay
+type ReplayChapter struct {
+	Time  float64 `json:"time"`
+	Title string  `json:"title"`
+}